@@ -0,0 +1,262 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"tubefeed/internal/db"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxURLFile limits the size of an uploaded list of urls
+const maxURLFile = 1 << 20
+
+const (
+	ResultAdded       = "added"
+	ResultDuplicate   = "duplicate"
+	ResultUnsupported = "unsupported"
+	ResultFailed      = "failed"
+)
+
+// addResult reports what happened to one url of a (bulk) add
+type addResult struct {
+	URL    string `json:"url"`
+	Result string `json:"result"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func newAddResult(videoURL string, vid meta.Video, err error) addResult {
+	r := addResult{URL: videoURL, Result: ResultAdded}
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		r.Result = ResultDuplicate
+	case errors.Is(err, meta.ErrUnsupported):
+		r.Result = ResultUnsupported
+		r.Error = err.Error()
+	case err != nil:
+		r.Result = ResultFailed
+		r.Error = err.Error()
+	default:
+		r.ID = vid.ID.String()
+	}
+	return r
+}
+
+// formURLs collects the urls of the youtube_url field and the optional
+// uploaded text file
+func formURLs(c *gin.Context) ([]string, error) {
+	urls := parseURLs(c.PostForm("youtube_url"))
+
+	file, err := c.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return urls, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	content, err := io.ReadAll(io.LimitReader(f, maxURLFile))
+	if err != nil {
+		return nil, err
+	}
+	return append(urls, parseURLs(string(content))...), nil
+}
+
+// parseURLs returns one url per non empty line. Lines from chats often
+// carry some text around the link, a line without link is returned as is
+// and reported as unsupported later.
+func parseURLs(text string) []string {
+	var urls []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if u := utils.ExtractURL(line); u != "" {
+			line = u
+		}
+		urls = append(urls, line)
+	}
+	return urls
+}
+
+// POST /audio/bulk
+//
+// Applies action to the videos selected in tab current. Retry without a
+// selection retries all failed videos of the tab.
+func (a App) bulkHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	current, err := strconv.Atoi(c.PostForm("current"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	videos, err := a.Db.LoadDatabase(ctx, current)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	ids := c.PostFormArray("id")
+	selected := selectVideos(videos, ids)
+
+	switch action := c.PostForm("action"); action {
+	case "delete":
+		err = a.deleteVideos(ctx, selected)
+	case "retry":
+		if len(ids) == 0 {
+			selected = videos
+		}
+		err = a.retryVideos(ctx, current, selected)
+	case "move":
+		var target int
+		target, err = strconv.Atoi(c.PostForm("tab"))
+		if err != nil {
+			log.Println(err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, err)
+			return
+		}
+		err = a.moveVideos(ctx, selected, target)
+	case "played", "unplayed":
+		err = a.Db.WithTx(ctx, func(tx *db.Database) error {
+			for _, video := range selected {
+				if err := tx.SetPlayed(ctx, video.ID, action == "played"); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		err = fmt.Errorf("unknown action: %q", action)
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+
+	videometa, err := a.loadVideoMeta(ctx, current)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.HTML(http.StatusOK, "video_list.html", gin.H{
+		"Videos": videometa,
+		"tab":    current,
+	})
+}
+
+// selectVideos returns the videos with one of ids, unknown ids are ignored
+func selectVideos(videos []meta.Video, ids []string) []meta.Video {
+	var selected []meta.Video
+	for _, video := range videos {
+		if slices.Contains(ids, video.ID.String()) {
+			selected = append(selected, video)
+		}
+	}
+	return selected
+}
+
+// deleteVideos deletes videos in one transaction, audio files are removed
+// once it is committed
+func (a App) deleteVideos(ctx context.Context, videos []meta.Video) error {
+	err := a.Db.WithTx(ctx, func(tx *db.Database) error {
+		for _, video := range videos {
+			if err := tx.DeleteVideo(ctx, video.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, video := range videos {
+		err = a.removeAudio(ctx, video.AudioID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryVideos queues the failed ones of videos for download again
+func (a App) retryVideos(ctx context.Context, tabid int, videos []meta.Video) error {
+	var failed []meta.Video
+	for _, video := range videos {
+		if video.Status == meta.StatusError {
+			failed = append(failed, video)
+		}
+	}
+	err := a.Db.WithTx(ctx, func(tx *db.Database) error {
+		for _, video := range failed {
+			if err := tx.SetStatus(ctx, video.ID, meta.StatusNew); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, video := range failed {
+		a.worker.Download(video, tabid)
+	}
+	return nil
+}
+
+// moveVideos moves videos to tab target, videos already present there stay
+func (a App) moveVideos(ctx context.Context, videos []meta.Video, target int) error {
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := tabs[target]; !ok {
+		return fmt.Errorf("tab %d does not exist", target)
+	}
+	var moved []meta.Video
+	err = a.Db.WithTx(ctx, func(tx *db.Database) error {
+		for _, video := range videos {
+			duplicate, err := tx.CheckforDuplicate(ctx, video, target)
+			if err != nil {
+				return err
+			}
+			if duplicate {
+				continue
+			}
+			if err := tx.MoveVideo(ctx, video.ID, target); err != nil {
+				return err
+			}
+			moved = append(moved, video)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, video := range moved {
+		a.retag(video)
+	}
+	return nil
+}
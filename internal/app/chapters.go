@@ -0,0 +1,41 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"tubefeed/internal/rss"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GET /chapters/:id.json
+func (a App) chaptersHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := uuid.Parse(strings.TrimSuffix(c.Param("id"), ".json"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	video, err := a.Db.GetVideo(ctx, id)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusNotFound, err)
+		return
+	}
+	c.Header("Content-Type", rss.ChaptersType)
+	c.JSON(http.StatusOK, rss.GenerateChapters(video))
+}
+
+// timestamp formats d as h:mm:ss or m:ss
+func timestamp(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tubefeed/internal/media"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+	"tubefeed/internal/rss"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestChaptersHandler(t *testing.T) {
+	a, _ := newTestServer(t)
+	ctx := context.Background()
+	id := uuid.New()
+	video := meta.Video{ID: id, AudioID: id, Ext: "mp3", Meta: provider.VideoMeta{
+		Title: "Episode",
+		URL:   "https://example.com/no-provider",
+		Chapters: []provider.Chapter{
+			{Start: 0, End: time.Minute, Title: "Intro"},
+			{Start: time.Minute, End: 3 * time.Minute, Title: "Main"},
+		},
+	}}
+	if err := a.Db.SaveVideoMetadata(ctx, video, 1, meta.StatusReady); err != nil {
+		t.Fatal(err)
+	}
+	err := a.Db.SetAudioFile(ctx, video.AudioID, provider.AudioFile{
+		Ext: "mp3",
+		Cut: []provider.Segment{{Start: 20 * time.Second, End: 40 * time.Second}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Db.SetProcessing(ctx, video.AudioID, []media.Outcome{
+		{Step: media.StepTrimSilence, Status: media.OutcomeApplied, Trimmed: 10 * time.Second},
+		{Step: media.StepSpeed, Status: media.OutcomeApplied, Tempo: 1.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/chapters/:id", a.chaptersHandler)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chapters/"+id.String()+".json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != rss.ChaptersType {
+		t.Errorf("content type = %q, want %q", ct, rss.ChaptersType)
+	}
+	var got rss.PodcastChapters
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []rss.PodcastChapter{
+		{StartTime: 0, EndTime: 20, Title: "Intro"},
+		{StartTime: 20, EndTime: 100, Title: "Main"},
+	}
+	if len(got.Chapters) != len(want) {
+		t.Fatalf("chapters = %+v, want %+v", got.Chapters, want)
+	}
+	for i := range want {
+		if got.Chapters[i] != want[i] {
+			t.Errorf("chapter %d = %+v, want %+v", i, got.Chapters[i], want[i])
+		}
+	}
+
+	for path, status := range map[string]int{
+		"/chapters/nope.json": http.StatusBadRequest,
+		"/chapters/00000000-0000-0000-0000-000000000000.json": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != status {
+			t.Errorf("%s: status = %d, want %d", path, rec.Code, status)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0:00"},
+		{59*time.Second + 600*time.Millisecond, "1:00"},
+		{61 * time.Second, "1:01"},
+		{59*time.Minute + 59*time.Second, "59:59"},
+		{time.Hour, "1:00:00"},
+		{10*time.Hour + 2*time.Minute + 3*time.Second, "10:02:03"},
+	}
+	for _, tc := range cases {
+		if got := timestamp(tc.d); got != tc.want {
+			t.Errorf("timestamp(%s) = %q, want %q", tc.d, got, tc.want)
+		}
+	}
+}
@@ -2,12 +2,18 @@ package app
 
 import (
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"slices"
+	"time"
 	"tubefeed/internal/config"
 	"tubefeed/internal/db"
+	"tubefeed/internal/media"
 	"tubefeed/internal/meta/worker"
+	"tubefeed/internal/provider/yt"
 	"tubefeed/internal/rss"
+	"tubefeed/internal/storage"
 
 	"github.com/gin-gonic/gin"
 
@@ -20,19 +26,49 @@ type App struct {
 	ExternalURL string
 	Db          *db.Database
 	worker      worker.Worker
+	store       storage.Storage // published audio files
 	version     string
 }
 
 func Setup(version string) App {
 	c := config.Load()
+	yt.SponsorBlockAPI = c.SponsorBlockAPI
+	yt.SubtitleLangs = c.SubtitleLangs
 
+	store, err := newStorage(c)
+	if err != nil {
+		log.Fatal(err)
+	}
 	return App{
 		config:  c,
 		rss:     rss.NewRSS(c.ExternalURL),
+		store:   store,
 		version: version,
 	}
 }
 
+// newStorage returns the storage for the published audio files
+func newStorage(c *config.Config) (storage.Storage, error) {
+	switch c.Storage {
+	case "", "fs":
+		return storage.NewFS(c.AudioPath), nil
+	case "s3":
+		if c.S3.Endpoint == "" || c.S3.Bucket == "" {
+			return nil, fmt.Errorf("s3 storage needs S3_ENDPOINT and S3_BUCKET")
+		}
+		return &storage.S3{
+			Endpoint:  c.S3.Endpoint,
+			Region:    c.S3.Region,
+			Bucket:    c.S3.Bucket,
+			AccessKey: c.S3.AccessKey,
+			SecretKey: c.S3.SecretKey,
+			PathStyle: c.S3.PathStyle,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", c.Storage)
+	}
+}
+
 // Run main app
 func (a App) Run() (err error) {
 
@@ -44,11 +80,32 @@ func (a App) Run() (err error) {
 	defer closedb()
 
 	var closeworker func()
-	a.worker, closeworker = worker.CreateWorkers(a.config.Workers, a.Db, a.config.AudioPath)
+	a.worker, closeworker = worker.CreateWorkers(a.config.Workers, a.Db, a.config.AudioPath, worker.SpeechToText{
+		Command: a.config.TranscribeCmd,
+		Lang:    a.config.TranscribeLang,
+		Workers: a.config.TranscribeWorkers,
+	}, a.config.EvictAfter, a.config.MinFree, a.store)
 	defer closeworker()
+	defer a.startJanitor(a.config.JanitorInterval)()
+	defer a.startGC(a.config.GCInterval)()
 
 	r := gin.Default()
 
+	r.SetFuncMap(template.FuncMap{
+		"bookmarklet": a.bookmarklet,
+		"contenttype": media.ContentType,
+		"sponsorblockcategories": func() []string {
+			return yt.SponsorBlockCategories
+		},
+		"contains":  slices.Contains[[]string],
+		"timestamp": timestamp,
+		"days": func(d time.Duration) int {
+			return int(d / (24 * time.Hour))
+		},
+		"megabytes": func(n int64) int64 {
+			return n >> 20
+		},
+	})
 	r.LoadHTMLGlob("templates/*")
 
 	r.Static("/static", "./static")
@@ -61,10 +118,33 @@ func (a App) Run() (err error) {
 	r.GET("/audio/status/:id", a.statusAudio)
 	// Stream or download audio route
 	r.GET("/audio/:id", a.streamAudio)
+	r.HEAD("/audio/:id", a.streamAudio)
+
+	// Apply an action to many videos at once
+	r.POST("/audio/bulk", a.bulkHandler)
 
 	// Route to delete a video by ID
 	r.DELETE("/audio/:id", a.audioIDhandler)
 
+	// Move or copy a video to another tab
+	r.GET("/audio/:id/menu", a.videoMenu)
+	r.POST("/audio/:id/move", a.moveAudio)
+	r.POST("/audio/:id/copy", a.copyAudio)
+
+	// Episode artwork
+	r.GET("/image/:id", a.imageHandler)
+
+	// Podcasting 2.0 chapters of a video
+	r.GET("/chapters/:id", a.chaptersHandler)
+	// transcripts from the subtitles of a video
+	r.GET("/transcript/:id", a.transcriptHandler)
+
+	// Add a video from a bookmarklet or share sheet
+	r.GET("/share", a.shareHandler)
+
+	// Search the videos of all tabs
+	r.GET("/search", a.searchHandler)
+
 	r.GET("/rss/:id", a.rssHandler)
 
 	r.GET("/content/:id", a.handlecontent)
@@ -72,7 +152,21 @@ func (a App) Run() (err error) {
 	r.GET("/tab", a.tablist)
 	r.GET("/tab/:id", a.tablist)
 	r.PATCH("/tab/:id", a.patchtab)
+	r.PATCH("/tab/:id/order", a.ordertab)
+	r.PATCH("/tab/:id/sort", a.sorttab)
+	r.PATCH("/tab/:id/audio", a.audiotab)
+	r.PATCH("/tab/:id/process", a.processtab)
+	r.PATCH("/tab/:id/sponsorblock", a.sponsorblocktab)
+	r.PATCH("/tab/:id/lazy", a.lazytab)
+	r.PATCH("/tab/:id/retention", a.retentiontab)
+	r.GET("/tab/:id/retention", a.retentionPreview)
+	r.PATCH("/tab/:id/quota", a.quotatab)
+	r.GET("/tab/:id/storage", a.tabStorage)
+
+	// Disk usage of the audio files
+	r.GET("/storage", a.storageHandler)
 	r.DELETE("/tab/:id", a.deleteTab)
+	r.GET("/tab/:id/zip", a.zipTab)
 	r.GET("/tab/edit/:id", a.edittab)
 	r.POST("/tab", a.createtab)
 	r.POST("/tab/:id", a.createtab) // Id just sets the active tab not new tabid
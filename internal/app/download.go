@@ -0,0 +1,116 @@
+package app
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/storage"
+	"tubefeed/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadName returns the file name of video following the configured
+// pattern, without extension
+func (a App) downloadName(video meta.Video, tab string) string {
+	var date string
+	if !video.Meta.UploadDate.IsZero() {
+		date = video.Meta.UploadDate.Format("2006-01-02")
+	}
+	name := strings.NewReplacer(
+		"{channel}", video.Meta.Channel,
+		"{title}", video.Meta.Title,
+		"{date}", date,
+		"{tab}", tab,
+		"{id}", video.ID.String(),
+	).Replace(a.config.FilenamePattern)
+	return utils.SanitizeFilename(name)
+}
+
+// GET /tab/:id/zip
+//
+// Downloads the available audio files of a tab as one zip archive
+func (a App) zipTab(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	tab, err := a.Db.GetTab(ctx, id)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusNotFound, err)
+		return
+	}
+	videos, err := a.loadVideoMeta(ctx, id)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", utils.ContentDisposition("attachment", utils.SanitizeFilename(tab.Name)+".zip"))
+	c.Status(http.StatusOK)
+
+	// the response has started, errors can only end the archive early
+	zw := zip.NewWriter(c.Writer)
+	defer func() {
+		if err := zw.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+	names := make(map[string]bool)
+	for _, video := range videos {
+		if video.Status != meta.StatusReady {
+			continue
+		}
+		obj, err := a.store.Open(ctx, audioName(video))
+		if errors.Is(err, storage.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		name := uniqueName(names, a.downloadName(video, tab.Name), "."+video.Ext)
+		err = addZipFile(zw, name, obj)
+		obj.Close()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+}
+
+// uniqueName returns name+ext, numbered when already taken
+func uniqueName(taken map[string]bool, name, ext string) string {
+	unique := name + ext
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", name, i, ext)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// addZipFile stores the file obj as name, audio files don't compress
+func addZipFile(zw *zip.Writer, name string, obj storage.Object) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: obj.Info().ModTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, obj)
+	return err
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+	"tubefeed/internal/db"
+	"tubefeed/internal/gc"
+)
+
+// gcMinAge protects files of downloads which started after the videos
+// were loaded
+const gcMinAge = time.Hour
+
+// startGC collects orphaned files and stale rows now and every interval
+// until the returned function is called
+func (a App) startGC(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r, err := gc.Collect(context.Background(), a.Db, a.config.AudioPath, a.store, gc.Options{MinAge: gcMinAge})
+			if err != nil {
+				log.Printf("gc: %v", err)
+			} else {
+				log.Printf("gc: %s", r)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// GC runs the garbage collector once from the command line, args are its
+// flags
+func (a App) GC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	minAge := fs.Duration("min-age", gcMinAge, "leave files younger than this alone")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	database, closedb, err := db.NewDatabase(a.config.DbPath)
+	if err != nil {
+		return err
+	}
+	defer closedb()
+	r, err := gc.Collect(context.Background(), database, a.config.AudioPath, a.store, gc.Options{DryRun: *dryRun, MinAge: *minAge})
+	if err != nil {
+		return err
+	}
+	for _, file := range r.Orphans {
+		fmt.Println("orphan:", file)
+	}
+	for _, file := range r.Temp {
+		fmt.Println("temporary:", file)
+	}
+	for _, id := range r.Missing {
+		fmt.Println("missing:", id)
+	}
+	if *dryRun {
+		fmt.Println("dry run, nothing was changed:", r)
+		return nil
+	}
+	fmt.Println(r)
+	return nil
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"tubefeed/internal/meta"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GET /audio/:id/menu
+func (a App) videoMenu(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.HTML(http.StatusOK, "videomenu.html", gin.H{"ID": id, "Tabs": tabs})
+}
+
+// POST /audio/:id/move
+func (a App) moveAudio(c *gin.Context) {
+	a.transferAudio(c, false)
+}
+
+// POST /audio/:id/copy
+func (a App) copyAudio(c *gin.Context) {
+	a.transferAudio(c, true)
+}
+
+// transferAudio moves or copies a video to the tab given in the form. Copies
+// share the audio file, so nothing is downloaded again.
+func (a App) transferAudio(c *gin.Context, copying bool) {
+	ctx := c.Request.Context()
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	tabid, err := strconv.Atoi(c.PostForm("tab"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	if _, ok := tabs[tabid]; !ok {
+		err = fmt.Errorf("tab %d does not exist", tabid)
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	video, err := a.Db.GetVideo(ctx, id)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	duplicate, err := a.Db.CheckforDuplicate(ctx, video, tabid)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	if duplicate {
+		c.JSON(http.StatusConflict, gin.H{"conflict": "Audio already present"})
+		return
+	}
+
+	if !copying {
+		err = a.Db.MoveVideo(ctx, id, tabid)
+		if err != nil {
+			log.Println(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+			return
+		}
+		a.retag(video)
+		// the video left this tab, remove its row
+		c.String(http.StatusOK, "")
+		return
+	}
+
+	// a copy made during download would never leave its pending status
+	if video.Status != meta.StatusReady && video.Status != meta.StatusOnDemand {
+		c.JSON(http.StatusConflict, gin.H{"conflict": "Audio is still processing"})
+		return
+	}
+	_, err = a.Db.CopyVideo(ctx, id, tabid)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.HTML(http.StatusOK, "video.html", video)
+}
+
+// retag updates the album tag of a moved video. Videos still downloading
+// are tagged by the worker when done, copies have the album of the original.
+func (a App) retag(video meta.Video) {
+	if video.Status != meta.StatusReady || video.AudioID != video.ID {
+		return
+	}
+	err := a.worker.Retag(video)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"tubefeed/internal/meta"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startJanitor deletes the episodes expired by the retention rules of the
+// tabs every interval until the returned function is called
+func (a App) startJanitor(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				a.expireAll(context.Background())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// expireAll applies the retention rules of all tabs
+func (a App) expireAll(ctx context.Context) {
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		log.Printf("janitor: %v", err)
+		return
+	}
+	for tabid, name := range tabs {
+		tab, err := a.loadTab(ctx, tabid)
+		if err != nil {
+			log.Printf("janitor: tab %s: %v", name, err)
+			continue
+		}
+		expired, err := a.expiredVideos(ctx, tab, tab.Retention)
+		if err != nil {
+			log.Printf("janitor: tab %s: %v", name, err)
+			continue
+		}
+		for _, video := range expired {
+			err = a.deleteVideo(ctx, video.ID)
+			if err != nil {
+				log.Printf("janitor: delete %s: %v", video.ID, err)
+				continue
+			}
+			log.Printf("janitor: tab %s: deleted %s", name, video.Meta.Title)
+		}
+	}
+}
+
+// expiredVideos returns the videos of tab which the rules remove now
+func (a App) expiredVideos(ctx context.Context, tab meta.Tab, rules meta.Retention) ([]meta.Video, error) {
+	if !rules.Enabled() {
+		return nil, nil
+	}
+	videos, err := a.Db.LoadDatabase(ctx, tab.ID)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Expired(videos, time.Now(), a.audioSize), nil
+}
+
+// audioSize returns the bytes of the audio file of video, 0 if it has none.
+// Files downloaded before sizes were recorded are looked up.
+func (a App) audioSize(video meta.Video) int64 {
+	if video.Size > 0 {
+		return video.Size
+	}
+	info, err := a.store.Stat(context.Background(), audioName(video))
+	if err != nil {
+		return 0
+	}
+	return info.Size
+}
+
+// retentionForm reads the retention rules of the tab settings form
+func retentionForm(value func(string) string) (meta.Retention, error) {
+	var r meta.Retention
+	var err error
+	number := func(key string) int {
+		if err != nil || value(key) == "" {
+			return 0
+		}
+		var n int
+		n, err = strconv.Atoi(value(key))
+		if err == nil && n < 0 {
+			err = strconv.ErrRange
+		}
+		return n
+	}
+	r.KeepLast = number("keep_last")
+	r.MaxAge = time.Duration(number("keep_days")) * 24 * time.Hour
+	r.MaxSize = int64(number("max_size")) << 20
+	r.KeepUnplayed = value("keep_unplayed") != ""
+	return r, err
+}
+
+// PATCH /tab/:id/retention -- change the rules expiring old episodes
+func (a App) retentiontab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	rules, err := retentionForm(c.PostForm)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	err = a.Db.SetTabRetention(ctx, tabid, rules)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /tab/:id/retention -- dry run of the retention rules in the query,
+// lists the episodes they would delete
+func (a App) retentionPreview(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	rules, err := retentionForm(c.Query)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	tab, err := a.loadTab(ctx, tabid)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	expired, err := a.expiredVideos(ctx, tab, rules)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.HTML(http.StatusOK, "retention.html", gin.H{"Videos": expired})
+}
@@ -4,25 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
-	"sync"
+	"time"
+	"tubefeed/internal/db"
+	"tubefeed/internal/media"
 	"tubefeed/internal/meta"
+	"tubefeed/internal/storage"
+	"tubefeed/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-var (
-	// Mutex to handle concurrent access during file download
-	downloadMutex        sync.Mutex
-	downloadAudioIDMutex = make(map[string]*sync.RWMutex)
-	downloadInProgress   sync.Map
-)
+var ErrDuplicate = errors.New("audio already present")
 
 // GET /
 func (a App) rootHandler(c *gin.Context) {
@@ -33,6 +33,12 @@ func (a App) rootHandler(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
+	settings, err := a.loadTab(ctx, 1)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
 	videometa, err := a.loadVideoMeta(c.Request.Context(), 1)
 	if err != nil {
 		log.Println(err)
@@ -40,17 +46,26 @@ func (a App) rootHandler(c *gin.Context) {
 		return
 	}
 	c.HTML(http.StatusOK, "index.html", gin.H{
-		"tab":    1,
-		"Tabs":   tabs,
-		"Videos": videometa,
+		"tab":      1,
+		"Tabs":     tabs,
+		"Videos":   videometa,
+		"Settings": settings,
 	})
 }
 
 // POST /audio
+//
+// Accepts one or many urls, one per line in youtube_url or in an uploaded
+// text file, and reports the result for each of them.
 func (a App) audioHandler(c *gin.Context) {
 	ctx := c.Request.Context()
-	videoURL := c.PostForm("youtube_url")
-	if videoURL == "" {
+	videoURLs, err := formURLs(c)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	if len(videoURLs) == 0 {
 		err := fmt.Errorf("no url provided")
 		log.Println(err)
 		c.AbortWithStatusJSON(http.StatusBadRequest, err)
@@ -63,52 +78,71 @@ func (a App) audioHandler(c *gin.Context) {
 		return
 	}
 
-	vid, err := meta.NewVideo(videoURL)
+	split := c.PostForm("split") != ""
+
+	results := make([]addResult, 0, len(videoURLs))
+	for _, videoURL := range videoURLs {
+		vid, err := a.addVideo(ctx, videoURL, tabid, split)
+		results = append(results, newAddResult(videoURL, vid, err))
+	}
+
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(http.StatusOK, gin.H{"results": results})
+		return
+	}
+
+	// Reload the page with the updated video list
+	videometa, err := a.loadVideoMeta(ctx, tabid)
 	if err != nil {
 		log.Println(err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
+	c.HTML(http.StatusOK, "add_result.html", gin.H{
+		"Videos":  videometa,
+		"tab":     tabid,
+		"Results": results,
+	})
+}
+
+// addVideo validates videoURL, stores it in tab tabid and queues the
+// download. split creates an episode per chapter once downloaded.
+func (a App) addVideo(ctx context.Context, videoURL string, tabid int, split bool) (meta.Video, error) {
+	vid, err := meta.NewVideo(videoURL)
+	if err != nil {
+		return meta.Video{}, err
+	}
+	vid.Split = split
 
 	duplicate, err := a.Db.CheckforDuplicate(ctx, vid, tabid)
 	if err != nil {
-		log.Println(err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
-		return
+		return vid, err
 	}
 	if duplicate {
-		c.JSON(http.StatusConflict, gin.H{"conflict": "Audio already present"})
-		return
+		return vid, ErrDuplicate
+	}
+	tab, err := a.loadTab(ctx, tabid)
+	if err != nil {
+		return vid, err
+	}
+	err = a.checkQuota(ctx, tab)
+	if err != nil {
+		return vid, err
 	}
 
 	err = a.Db.SaveVideoMetadata(ctx, vid, tabid, meta.StatusNew)
 	if err != nil {
 		log.Printf("dberror: %v", err)
-		err = a.Db.SetStatus(ctx, vid.ID, meta.StatusError)
-		if err != nil {
+		err2 := a.Db.SetStatus(ctx, vid.ID, meta.StatusError)
+		if err2 != nil {
 			// errception
-			log.Printf("dberror: %v", err)
+			log.Printf("dberror: %v", err2)
 		}
-		return
+		return vid, err
 	}
 	// send download to worker
-	err = a.worker.Download(vid, tabid)
-	if err != nil {
-		log.Println(err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
-		return
-	}
-
-	// Reload the page with the updated video list
-	videometa, err := a.loadVideoMeta(ctx, tabid)
-	if err != nil {
-		log.Println(err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
-		return
-	}
-	c.HTML(http.StatusOK, "video_list.html", gin.H{
-		"Videos": videometa,
-	})
+	a.worker.Download(vid, tabid)
+	return vid, nil
 }
 
 // GET /audio/:id
@@ -151,9 +185,21 @@ func (a App) statusAudio(c *gin.Context) {
 
 func (a App) handlecontent(c *gin.Context) {
 	ctx := c.Request.Context()
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
 	tabID := c.Param("id")
 	if tabID == "" || tabID == "1" {
-		videometa, err := a.Db.LoadDatabase(ctx, 1)
+		settings, err := a.loadTab(ctx, 1)
+		if err != nil {
+			log.Println(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+			return
+		}
+		videometa, err := a.loadVideoMeta(ctx, 1)
 		if err != nil {
 			log.Println(err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
@@ -162,13 +208,17 @@ func (a App) handlecontent(c *gin.Context) {
 
 		if tabID == "" {
 			c.HTML(http.StatusOK, "index.html", gin.H{
-				"Videos": videometa,
-				"tab":    1,
+				"Videos":   videometa,
+				"tab":      1,
+				"Tabs":     tabs,
+				"Settings": settings,
 			})
 		} else {
 			c.HTML(http.StatusOK, "tabcontent.html", gin.H{
-				"Videos": videometa,
-				"tab":    1,
+				"Videos":   videometa,
+				"tab":      1,
+				"Tabs":     tabs,
+				"Settings": settings,
 			})
 		}
 
@@ -179,6 +229,12 @@ func (a App) handlecontent(c *gin.Context) {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 			return
 		}
+		settings, err := a.loadTab(ctx, tabIDi)
+		if err != nil {
+			log.Println(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+			return
+		}
 		videometa, err := a.loadVideoMeta(ctx, tabIDi)
 		if err != nil {
 			log.Println(err)
@@ -186,102 +242,292 @@ func (a App) handlecontent(c *gin.Context) {
 			return
 		}
 		c.HTML(http.StatusOK, "tabcontent.html", gin.H{
-			"Videos": videometa,
-			"tab":    tabIDi,
+			"Videos":   videometa,
+			"tab":      tabIDi,
+			"Tabs":     tabs,
+			"Settings": settings,
 		})
 	}
 }
 
+// loadTab returns the settings of tab, a missing tab gets the defaults
+func (a App) loadTab(ctx context.Context, tab int) (meta.Tab, error) {
+	settings, err := a.Db.GetTab(ctx, tab)
+	if errors.Is(err, db.ErrNotFound) {
+		return meta.Tab{ID: tab, Sort: meta.SortManual}, nil
+	}
+	return settings, err
+}
+
+// loadVideoMeta returns the videos of tab in the order configured for it
 func (a App) loadVideoMeta(ctx context.Context, tab int) ([]meta.Video, error) {
+	settings, err := a.loadTab(ctx, tab)
+	if err != nil {
+		return nil, err
+	}
 	videos, err := a.Db.LoadDatabase(ctx, tab)
 	if err != nil {
 		return nil, err
 	}
+	meta.SortVideos(videos, settings.Sort)
 	return videos, nil
 }
 
+// GET and HEAD /audio/:id -- stream the audio of a video, ranges and
+// conditional requests are supported. Missing audio is downloaded by GET
+// requests. Listeners from the start get it while it downloads, joining
+// a running stream, the others 503 until it is ready.
 func (a App) streamAudio(c *gin.Context) {
 	ctx := c.Request.Context()
-	audioID := c.Param("id")
-	audioUUID, err := uuid.Parse(audioID)
+	audioUUID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		log.Println(err)
 		c.AbortWithStatusJSON(http.StatusBadRequest, err)
 		return
 	}
-	audioFilePath := filepath.Join(a.config.AudioPath, fmt.Sprintf("%s.mp3", audioID))
-
-	// Check if the file exists
-	if fileExists(audioFilePath) {
-		if _, ok := c.GetQuery("download"); ok {
-			c.Header("Content-Type", "application/octet-stream")
-			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.mp3", audioID))
-			c.File(audioFilePath)
-			return
+	video, err := a.Db.GetVideo(ctx, audioUUID)
+	if errors.Is(err, db.ErrNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"msg": "unknown video"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	_, check := c.GetQuery("check")
+	if c.Request.Method == http.MethodGet && !check {
+		// lazy tabs evict audio nobody listens to
+		err = a.Db.TouchAudio(ctx, video.AudioID, time.Now())
+		if err != nil {
+			log.Println(err)
 		}
-		if _, ok := c.GetQuery("check"); ok {
+	}
+
+	// Check if the file exists, opening it reads its metadata once
+	if obj, err := a.store.Open(ctx, audioName(video)); err == nil {
+		defer obj.Close()
+		if check {
 			c.Status(http.StatusOK)
 			return
 		}
-		c.Header("Content-Type", "audio/mpeg")
-		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s.mp3", audioID))
-		c.File(audioFilePath)
+		a.serveAudio(c, video, obj)
+		return
+	} else if !errors.Is(err, storage.ErrNotExist) {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
 
-	// Check if a download is already in progress
-	if inProgress, _ := downloadInProgress.Load(audioID); inProgress == true {
-		// Return early with a message indicating the download is in progress
-		log.Printf("download of id %s in progress\n", audioID)
-		c.JSON(http.StatusProcessing, gin.H{"message": "Audio download in progress, please try again later"})
+	// the worker is still loading the metadata, it downloads the audio next
+	if video.Status == meta.StatusNew || video.Status == meta.StatusMeta {
+		audioUnavailable(c, "Audio download in progress, please try again later")
 		return
 	}
-
-	downloadInProgress.Store(audioID, true)
-	defer downloadInProgress.Delete(audioID)
-
-	// File does not exist, attempt to download it
-	downloadMutex.Lock()
-	// Ensure that we have a mutex for the audioID
-	if _, ok := downloadAudioIDMutex[audioID]; !ok {
-		downloadAudioIDMutex[audioID] = &sync.RWMutex{}
+	// only requests for the audio itself download it
+	if check || c.Request.Method == http.MethodHead {
+		audioUnavailable(c, "Audio is not downloaded")
+		return
 	}
-	audioMutex := downloadAudioIDMutex[audioID]
-	defer downloadMutex.Unlock()
-
-	audioMutex.Lock()
+	_, download := c.GetQuery("download")
+	if download || !fromStart(c.GetHeader("Range")) {
+		// joins a running download of the audio file
+		go func() {
+			err := a.worker.Fetch(context.Background(), video, video.Tabid)
+			if err != nil {
+				log.Println(err)
+			}
+		}()
+		audioUnavailable(c, "Audio is processing")
+		return
+	}
+	// the first listener gets the audio while it downloads
+	live := a.worker.Stream(ctx, video, video.Tabid)
+	if live == nil {
+		audioUnavailable(c, "Audio is processing")
+		return
+	}
+	c.Header("Content-Type", live.ContentType)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	r := live.NewReader()
+	defer r.Close()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Println(err)
+			}
+			return
+		}
+	}
+}
 
-	if !fileExists(audioFilePath) {
-		video, err := a.Db.GetVideo(ctx, audioUUID)
+// serveAudio sends the stored audio file obj of video, or redirects to a
+// presigned url of it. Presigned urls expire, so the feed keeps linking
+// to tubefeed.
+func (a App) serveAudio(c *gin.Context, video meta.Video, obj storage.Object) {
+	ctx := c.Request.Context()
+	tab, err := a.loadTab(ctx, video.Tabid)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	disposition := utils.ContentDisposition("inline", a.downloadName(video, tab.Name)+"."+video.Ext)
+	contentType := media.ContentType(video.Ext)
+	if _, ok := c.GetQuery("download"); ok {
+		disposition = utils.ContentDisposition("attachment", a.downloadName(video, tab.Name)+"."+video.Ext)
+		contentType = "application/octet-stream"
+	}
+	if p, ok := a.store.(storage.Presigner); ok && a.config.S3.Presign > 0 {
+		u, err := p.PresignGet(obj.Info().Name, a.config.S3.Presign, disposition)
 		if err != nil {
 			log.Println(err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 			return
 		}
-		go func() {
-			defer audioMutex.Unlock()
-			err := video.Download(audioFilePath)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-		}()
+		c.Redirect(http.StatusFound, u)
+		return
 	}
-	c.JSON(http.StatusProcessing, gin.H{"msg": "Audio is processing"})
+	// http.ServeContent answers ranges, HEAD and conditional requests
+	// and sets Last-Modified, the ETag changes with the file
+	info := obj.Info()
+	c.Header("ETag", fmt.Sprintf(`"%s-%x-%x"`, video.AudioID, info.Size, info.ModTime.UnixNano()))
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", disposition)
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, obj)
 }
 
-// Deletes a video by ID from the database
+// fromStart reports if the Range header asks for the whole file, streamed
+// audio has no length yet
+func fromStart(rng string) bool {
+	return rng == "" || rng == "bytes=0-"
+}
+
+// audioRetryAfter is the time podcast apps are asked to wait for a download
+const audioRetryAfter = 30 * time.Second
+
+// audioUnavailable answers requests for audio which is not downloaded yet
+func audioUnavailable(c *gin.Context, msg string) {
+	c.Header("Retry-After", strconv.Itoa(int(audioRetryAfter.Seconds())))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"msg": msg})
+}
+
+// Deletes a video by ID from the database together with the chapter
+// episodes split from it. An audio file is removed once no other video
+// references it.
 func (a App) deleteVideo(ctx context.Context, id uuid.UUID) error {
-	err := a.Db.DeleteVideo(ctx, id)
+	video, err := a.Db.GetVideo(ctx, id)
+	if err != nil {
+		return err
+	}
+	children, err := a.Db.Children(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		err = a.Db.DeleteVideo(ctx, child.ID)
+		if err != nil {
+			return err
+		}
+		err = a.removeAudio(ctx, child.AudioID)
+		if err != nil {
+			return err
+		}
+	}
+	err = a.Db.DeleteVideo(ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.removeAudio(ctx, video.AudioID)
+}
+
+// removeAudio deletes the audio file audioID and the files next to it
+// unless a video still uses it
+func (a App) removeAudio(ctx context.Context, audioID uuid.UUID) error {
+	refs, err := a.Db.AudioReferences(ctx, audioID)
 	if err != nil {
 		return err
 	}
-	file := fmt.Sprintf("%s/%s.mp3", a.config.AudioPath, id)
-	err = os.Remove(file)
-	if errors.Is(err, fs.ErrNotExist) {
+	if refs > 0 {
 		return nil
 	}
-	return err
+	err = a.Db.DeleteChapters(ctx, audioID)
+	if err != nil {
+		return err
+	}
+	// the audio file, its artwork and files left by an older audio format
+	files, err := filepath.Glob(filepath.Join(a.config.AudioPath, audioID.String()+".*"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		err = os.Remove(file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	// published files, the local ones are gone already if they are the same
+	stored, err := a.store.List(ctx, audioID.String()+".")
+	if err != nil {
+		return err
+	}
+	for _, file := range stored {
+		err = a.store.Delete(ctx, file.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GET /image/:id
+//
+// Serves the episode artwork. Videos without a local image redirect to
+// the thumbnail of the provider or the feed logo.
+func (a App) imageHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	video, err := a.Db.GetVideo(ctx, id)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusNotFound, err)
+		return
+	}
+	imagePath := a.imageFile(video.AudioID)
+	if fileExists(imagePath) {
+		c.Header("Content-Type", "image/jpeg")
+		c.File(imagePath)
+		return
+	}
+	if video.Meta.Thumbnail != "" {
+		c.Redirect(http.StatusFound, video.Meta.Thumbnail)
+		return
+	}
+	c.Redirect(http.StatusFound, "/static/logo.png")
+}
+
+// audioName is the name of the audio file of video in the storage
+func audioName(video meta.Video) string {
+	return fmt.Sprintf("%s.%s", video.AudioID, video.Ext)
+}
+
+// imageFile returns the path of the artwork belonging to audio file id
+func (a App) imageFile(id uuid.UUID) string {
+	return filepath.Join(a.config.AudioPath, fmt.Sprintf("%s.jpg", id))
 }
 
 func fileExists(filePath string) bool {
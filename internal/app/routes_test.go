@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+)
+
+func TestDeleteVideoWithChildren(t *testing.T) {
+	a, _ := newTestServer(t)
+	ctx := context.Background()
+	parent := addTestVideo(t, a, meta.StatusReady, []byte("parent"))
+	parent.Meta.Chapters = []provider.Chapter{
+		{Start: 0, End: time.Minute, Title: "Intro"},
+		{Start: time.Minute, End: 2 * time.Minute, Title: "Main"},
+	}
+	other := addTestVideo(t, a, meta.StatusReady, []byte("other"))
+
+	var children []meta.Video
+	for i := range parent.Meta.Chapters {
+		child := parent.ChapterEpisode(i)
+		err := a.Db.SaveVideoMetadata(ctx, child, 1, meta.StatusReady)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(a.config.AudioPath, audioName(child)), []byte(child.Meta.Title), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, child)
+	}
+
+	if err := a.deleteVideo(ctx, parent.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, video := range append(children, parent) {
+		if _, err := a.Db.GetVideo(ctx, video.ID); err == nil {
+			t.Errorf("%s is still in the database", video.Meta.Title)
+		}
+		_, err := os.Stat(filepath.Join(a.config.AudioPath, audioName(video)))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("audio of %s: %v", video.Meta.Title, err)
+		}
+	}
+	if _, err := a.Db.GetVideo(ctx, other.ID); err != nil {
+		t.Errorf("unrelated video: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(a.config.AudioPath, audioName(other))); err != nil {
+		t.Errorf("audio of unrelated video: %v", err)
+	}
+}
@@ -19,27 +19,21 @@ func (a App) rssHandler(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
-	videos, err := a.Db.LoadDatabase(ctx, id)
+	tab, err := a.Db.GetTab(ctx, id)
 	if err != nil {
+		err = fmt.Errorf("failed to get tab for id %d: %w", id, err)
 		log.Println(err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
-	tabs, err := a.Db.LoadTabs(ctx)
+	videos, err := a.loadVideoMeta(ctx, id)
 	if err != nil {
 		log.Println(err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
-	tabname, ok := tabs[id]
-	if !ok {
-		err = fmt.Errorf("failed to get tabname for id %d", id)
-		log.Println(err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
-		return
-	}
 	// Generate Podcast RSS feed with the video metadata
-	rssfeed, err := a.rss.GeneratePodcastFeed(videos, tabname)
+	rssfeed, err := a.rss.GeneratePodcastFeed(videos, tab)
 	if err != nil {
 		log.Println(err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tubefeed/internal/meta"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchFilter narrows search results, zero values match everything
+type searchFilter struct {
+	Status  meta.Status
+	Channel string
+	Tab     int
+	Min     time.Duration
+	Max     time.Duration
+}
+
+func (f searchFilter) match(video meta.Video) bool {
+	switch {
+	case f.Status != "" && video.Status != f.Status:
+		return false
+	case f.Channel != "" && !strings.EqualFold(video.Meta.Channel, f.Channel):
+		return false
+	case f.Tab != 0 && video.Tabid != f.Tab:
+		return false
+	case f.Min != 0 && video.Meta.Length < f.Min:
+		return false
+	case f.Max != 0 && video.Meta.Length > f.Max:
+		return false
+	}
+	return true
+}
+
+// searchResult is a search hit as returned by the JSON API
+type searchResult struct {
+	ID      string `json:"id"`
+	Tab     int    `json:"tab"`
+	TabName string `json:"tab_name"`
+	Title   string `json:"title"`
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+	Length  int    `json:"length"` // seconds
+	URL     string `json:"url"`
+}
+
+// GET /search?q=...&status=...&channel=...&tab=...&min=...&max=...
+//
+// Searches title, channel and description of the videos of all tabs. min
+// and max limit the duration in minutes. Responds with JSON if requested
+// by the Accept header.
+func (a App) searchHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	filter, err := parseSearchFilter(c)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	videos, err := a.Db.Search(ctx, c.Query("q"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+
+	var matches []meta.Video
+	for _, video := range videos {
+		if filter.match(video) {
+			matches = append(matches, video)
+		}
+	}
+
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		results := make([]searchResult, 0, len(matches))
+		for _, video := range matches {
+			results = append(results, searchResult{
+				ID:      video.ID.String(),
+				Tab:     video.Tabid,
+				TabName: tabs[video.Tabid],
+				Title:   video.Meta.Title,
+				Channel: video.Meta.Channel,
+				Status:  string(video.Status),
+				Length:  int(video.Meta.Length.Seconds()),
+				URL:     video.Meta.URL,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results})
+		return
+	}
+	c.HTML(http.StatusOK, "search.html", gin.H{
+		"Query":  c.Query("q"),
+		"Videos": matches,
+		"Tabs":   tabs,
+	})
+}
+
+func parseSearchFilter(c *gin.Context) (searchFilter, error) {
+	filter := searchFilter{
+		Status:  meta.Status(c.Query("status")),
+		Channel: strings.TrimSpace(c.Query("channel")),
+	}
+	var err error
+	if tab := c.Query("tab"); tab != "" {
+		filter.Tab, err = strconv.Atoi(tab)
+		if err != nil {
+			return filter, fmt.Errorf("invalid tab: %w", err)
+		}
+	}
+	if lower := c.Query("min"); lower != "" {
+		minutes, err := strconv.Atoi(lower)
+		if err != nil {
+			return filter, fmt.Errorf("invalid min: %w", err)
+		}
+		filter.Min = time.Duration(minutes) * time.Minute
+	}
+	if upper := c.Query("max"); upper != "" {
+		minutes, err := strconv.Atoi(upper)
+		if err != nil {
+			return filter, fmt.Errorf("invalid max: %w", err)
+		}
+		filter.Max = time.Duration(minutes) * time.Minute
+	}
+	return filter, nil
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestParseSearchFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/search?status=Available&channel=+Gophers+&tab=2&min=5&max=60", nil)
+	filter, err := parseSearchFilter(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := searchFilter{Status: meta.StatusReady, Channel: "Gophers", Tab: 2, Min: 5 * time.Minute, Max: time.Hour}
+	if filter != want {
+		t.Errorf("filter = %+v, want %+v", filter, want)
+	}
+
+	for _, query := range []string{"tab=x", "min=x", "max=1.5"} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/search?"+query, nil)
+		if _, err := parseSearchFilter(c); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
+
+func TestSearchFilterMatch(t *testing.T) {
+	video := meta.Video{
+		Status: meta.StatusReady,
+		Tabid:  2,
+		Meta:   provider.VideoMeta{Channel: "Gophers", Length: 30 * time.Minute},
+	}
+	cases := []struct {
+		filter searchFilter
+		want   bool
+	}{
+		{searchFilter{}, true},
+		{searchFilter{Status: meta.StatusReady, Channel: "gophers", Tab: 2}, true},
+		{searchFilter{Status: meta.StatusError}, false},
+		{searchFilter{Channel: "Chef"}, false},
+		{searchFilter{Tab: 1}, false},
+		{searchFilter{Min: 10 * time.Minute, Max: time.Hour}, true},
+		{searchFilter{Min: time.Hour}, false},
+		{searchFilter{Max: 10 * time.Minute}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.filter.match(video); got != tc.want {
+			t.Errorf("%+v.match() = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	a, _ := newTestServer(t)
+	ctx := context.Background()
+	for i, md := range []provider.VideoMeta{
+		{Title: "Learning Golang", Channel: "Gophers", Length: 30 * time.Minute, URL: "https://example.com/a"},
+		{Title: "Golang in production", Channel: "Ops", Length: 90 * time.Minute, URL: "https://example.com/b"},
+		{Title: "Cooking pasta", Channel: "Chef", Length: 20 * time.Minute, URL: "https://example.com/c"},
+	} {
+		id := uuid.New()
+		err := a.Db.SaveVideoMetadata(ctx, meta.Video{ID: id, AudioID: id, Ext: "mp3", Meta: md}, 1+i%2, meta.StatusReady)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := gin.New()
+	r.GET("/search", a.searchHandler)
+
+	cases := map[string][]string{
+		"/search?q=golang":         {"Learning Golang", "Golang in production"},
+		"/search?q=golang&max=60":  {"Learning Golang"},
+		"/search?q=golang&tab=2":   {"Golang in production"},
+		"/search?channel=chef":     {"Cooking pasta"},
+		"/search?q=golang&status=": {"Learning Golang", "Golang in production"},
+		"/search?q=nothing":        {},
+	}
+	for url, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s = %d: %s", url, rec.Code, rec.Body)
+		}
+		var body struct {
+			Results []searchResult `json:"results"`
+		}
+		err := json.Unmarshal(rec.Body.Bytes(), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]bool)
+		for _, res := range body.Results {
+			got[res.Title] = true
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s = %v, want %v", url, body.Results, want)
+		}
+		for _, title := range want {
+			if !got[title] {
+				t.Errorf("%s: missing %q in %v", url, title, body.Results)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /share?url=...&tab=...
+//
+// Share endpoint for bookmarklets and the web app share target. Without a
+// tab a page to choose one is rendered.
+func (a App) shareHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	videoURL := c.Query("url")
+	if videoURL == "" {
+		// Android share sheets put the link into the text parameter
+		videoURL = utils.ExtractURL(c.Query("text"))
+	}
+	if videoURL == "" {
+		c.HTML(http.StatusBadRequest, "share.html", gin.H{"Error": "no url provided"})
+		return
+	}
+
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	if c.Query("tab") == "" {
+		c.HTML(http.StatusOK, "share.html", gin.H{"URL": videoURL, "Tabs": tabs})
+		return
+	}
+	tabid, err := strconv.Atoi(c.Query("tab"))
+	if err != nil {
+		log.Println(err)
+		c.HTML(http.StatusBadRequest, "share.html", gin.H{"URL": videoURL, "Error": "invalid tab"})
+		return
+	}
+	tabname, ok := tabs[tabid]
+	if !ok {
+		c.HTML(http.StatusNotFound, "share.html", gin.H{"URL": videoURL, "Error": fmt.Sprintf("tab %d does not exist", tabid)})
+		return
+	}
+
+	vid, err := a.addVideo(ctx, videoURL, tabid, false)
+	switch {
+	case errors.Is(err, ErrDuplicate):
+		c.HTML(http.StatusConflict, "share.html", gin.H{"URL": videoURL, "Tab": tabname, "Error": "audio already present"})
+	case errors.Is(err, meta.ErrUnsupported):
+		c.HTML(http.StatusBadRequest, "share.html", gin.H{"URL": videoURL, "Tab": tabname, "Error": err.Error()})
+	case err != nil:
+		log.Println(err)
+		c.HTML(http.StatusInternalServerError, "share.html", gin.H{"URL": videoURL, "Tab": tabname, "Error": err.Error()})
+	default:
+		c.HTML(http.StatusOK, "share.html", gin.H{"URL": vid.Meta.URL, "Tab": tabname, "Added": true})
+	}
+}
+
+// bookmarklet returns a javascript url sharing the current page into tab
+func (a App) bookmarklet(tab int) template.URL {
+	js := fmt.Sprintf(
+		"javascript:location.href='http://%s/share?tab=%d&url='+encodeURIComponent(location.href)",
+		a.config.ExternalURL, tab,
+	)
+	return template.URL(js)
+}
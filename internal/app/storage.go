@@ -0,0 +1,182 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrQuota is returned for new episodes of tabs over their storage quota
+var ErrQuota = errors.New("storage quota exceeded")
+
+// tabStorage is the disk usage of a tab
+type tabStorage struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+	Quota int64  `json:"quota"` // 0 is unlimited
+}
+
+// diskUsage is the disk usage of all tabs
+type diskUsage struct {
+	Bytes int64        `json:"bytes"`
+	Quota int64        `json:"quota"` // 0 is unlimited
+	Free  int64        `json:"free"`  // -1 if unknown
+	Tabs  []tabStorage `json:"tabs"`
+}
+
+// loadStorage collects the disk usage of all tabs
+func (a App) loadStorage(ctx context.Context) (diskUsage, error) {
+	tabs, err := a.Db.LoadTabs(ctx)
+	if err != nil {
+		return diskUsage{}, err
+	}
+	usage, err := a.Db.TabUsage(ctx)
+	if err != nil {
+		return diskUsage{}, err
+	}
+	s := diskUsage{Quota: a.config.Quota, Free: -1, Tabs: make([]tabStorage, 0, len(tabs))}
+	s.Bytes, err = a.Db.TotalUsage(ctx)
+	if err != nil {
+		return diskUsage{}, err
+	}
+	free, err := utils.FreeSpace(a.config.AudioPath)
+	if err == nil {
+		s.Free = free
+	}
+	for _, id := range slices.Sorted(maps.Keys(tabs)) {
+		name := tabs[id]
+		tab, err := a.loadTab(ctx, id)
+		if err != nil {
+			return diskUsage{}, err
+		}
+		s.Tabs = append(s.Tabs, tabStorage{
+			ID:    id,
+			Name:  name,
+			Files: usage[id].Files,
+			Bytes: usage[id].Bytes,
+			Quota: tab.Quota,
+		})
+	}
+	return s, nil
+}
+
+// checkQuota fails with ErrQuota if the audio files of tab or of all tabs
+// reached their quota. The retention rules of tab are applied first to
+// make room.
+func (a App) checkQuota(ctx context.Context, tab meta.Tab) error {
+	over, err := a.overQuota(ctx, tab)
+	if err != nil || over == "" {
+		return err
+	}
+	expired, err := a.expiredVideos(ctx, tab, tab.Retention)
+	if err != nil {
+		return err
+	}
+	for _, video := range expired {
+		err = a.deleteVideo(ctx, video.ID)
+		if err != nil {
+			return err
+		}
+		log.Printf("quota: tab %s: deleted %s", tab.Name, video.Meta.Title)
+	}
+	over, err = a.overQuota(ctx, tab)
+	if err != nil || over == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrQuota, over)
+}
+
+// overQuota describes the quota tab exceeds, empty if there is none
+func (a App) overQuota(ctx context.Context, tab meta.Tab) (string, error) {
+	if tab.Quota > 0 {
+		usage, err := a.Db.TabUsage(ctx)
+		if err != nil {
+			return "", err
+		}
+		if usage[tab.ID].Bytes >= tab.Quota {
+			return fmt.Sprintf("tab uses %d of %d MB", usage[tab.ID].Bytes>>20, tab.Quota>>20), nil
+		}
+	}
+	if a.config.Quota > 0 {
+		total, err := a.Db.TotalUsage(ctx)
+		if err != nil {
+			return "", err
+		}
+		if total >= a.config.Quota {
+			return fmt.Sprintf("all tabs use %d of %d MB", total>>20, a.config.Quota>>20), nil
+		}
+	}
+	return "", nil
+}
+
+// GET /storage -- disk usage of all tabs as json
+func (a App) storageHandler(c *gin.Context) {
+	s, err := a.loadStorage(c.Request.Context())
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// GET /tab/:id/storage -- disk usage of the tab and of all tabs
+func (a App) tabStorage(c *gin.Context) {
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	s, err := a.loadStorage(c.Request.Context())
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	tab := tabStorage{ID: tabid}
+	for _, t := range s.Tabs {
+		if t.ID == tabid {
+			tab = t
+		}
+	}
+	c.HTML(http.StatusOK, "storage.html", gin.H{"Storage": s, "Tab": tab})
+}
+
+// PATCH /tab/:id/quota -- change the MB of audio the tab may use
+func (a App) quotatab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	quota, err := strconv.ParseInt(c.DefaultPostForm("quota", "0"), 10, 64)
+	if err == nil && quota < 0 {
+		err = strconv.ErrRange
+	}
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	err = a.Db.SetTabQuota(ctx, tabid, quota<<20)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
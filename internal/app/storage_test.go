@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"tubefeed/internal/meta"
+)
+
+func TestCheckQuota(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestServer(t)
+	tabid := 1
+	for i := range 2 {
+		video := addTestVideo(t, a, meta.StatusReady, []byte("audio"))
+		err := a.Db.SetAudioSize(ctx, video.AudioID, int64(i+1)<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	usage, err := a.Db.TabUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usage[tabid]; got.Files != 2 || got.Bytes != 3<<20 {
+		t.Fatalf("usage %+v, want 2 files of 3 MB", got)
+	}
+
+	a.config.Quota = 4 << 20
+	tab := meta.Tab{ID: tabid, Name: "Tab"}
+	if err = a.checkQuota(ctx, tab); err != nil {
+		t.Errorf("under the global quota: %v", err)
+	}
+	tab.Quota = 3 << 20
+	if err = a.checkQuota(ctx, tab); !errors.Is(err, ErrQuota) {
+		t.Errorf("at the tab quota: got %v, want ErrQuota", err)
+	}
+	// the retention rules make room
+	tab.Retention = meta.Retention{KeepLast: 1}
+	if err = a.checkQuota(ctx, tab); err != nil {
+		t.Errorf("with retention: %v", err)
+	}
+	usage, err = a.Db.TabUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usage[tabid]; got.Files != 1 {
+		t.Errorf("usage %+v after retention, want 1 file", got)
+	}
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"tubefeed/internal/config"
+	"tubefeed/internal/db"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/meta/worker"
+	"tubefeed/internal/provider"
+	"tubefeed/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestServer serves the audio routes from a fresh database and audio
+// directory
+func newTestServer(t *testing.T) (App, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	database, closedb, err := db.NewDatabase(filepath.Join(dir, "tubefeed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(closedb)
+	a := App{
+		config: &config.Config{AudioPath: dir, FilenamePattern: "{title}"},
+		Db:     database,
+		store:  storage.NewFS(dir),
+	}
+	var closeworker func()
+	a.worker, closeworker = worker.CreateWorkers(0, database, dir, worker.SpeechToText{}, 0, 0, a.store)
+	t.Cleanup(closeworker)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/audio/:id", a.streamAudio)
+	r.HEAD("/audio/:id", a.streamAudio)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return a, srv
+}
+
+// addTestVideo stores a video with status and, if audio is set, its file
+func addTestVideo(t *testing.T, a App, status meta.Status, audio []byte) meta.Video {
+	t.Helper()
+	id := uuid.New()
+	video := meta.Video{
+		ID:      id,
+		AudioID: id,
+		Ext:     "mp3",
+		Meta:    provider.VideoMeta{Title: "Episode", URL: "https://example.com/no-provider"},
+	}
+	err := a.Db.SaveVideoMetadata(context.Background(), video, 1, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audio != nil {
+		err = os.WriteFile(filepath.Join(a.config.AudioPath, audioName(video)), audio, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return video
+}
+
+func request(t *testing.T, method, url string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestStreamAudio(t *testing.T) {
+	a, srv := newTestServer(t)
+	audio := []byte("0123456789abcdef")
+	video := addTestVideo(t, a, meta.StatusReady, audio)
+	url := srv.URL + "/audio/" + video.ID.String()
+
+	resp, body := request(t, http.MethodGet, url, nil)
+	if resp.StatusCode != http.StatusOK || body != string(audio) {
+		t.Fatalf("GET = %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "audio/mpeg" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Accept-Ranges = %q", resp.Header.Get("Accept-Ranges"))
+	}
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("ETag = %q, Last-Modified = %q", etag, lastModified)
+	}
+
+	t.Run("range", func(t *testing.T) {
+		resp, body := request(t, http.MethodGet, url, map[string]string{"Range": "bytes=2-5"})
+		if resp.StatusCode != http.StatusPartialContent || body != "2345" {
+			t.Fatalf("GET range = %d %q", resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("Content-Range"); got != "bytes 2-5/16" {
+			t.Errorf("Content-Range = %q", got)
+		}
+	})
+
+	t.Run("suffix range", func(t *testing.T) {
+		resp, body := request(t, http.MethodGet, url, map[string]string{"Range": "bytes=-3"})
+		if resp.StatusCode != http.StatusPartialContent || body != "def" {
+			t.Fatalf("GET range = %d %q", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("unsatisfiable range", func(t *testing.T) {
+		resp, _ := request(t, http.MethodGet, url, map[string]string{"Range": "bytes=100-"})
+		if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("GET range = %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("if-range with old etag", func(t *testing.T) {
+		resp, body := request(t, http.MethodGet, url, map[string]string{"Range": "bytes=2-5", "If-Range": `"old"`})
+		if resp.StatusCode != http.StatusOK || body != string(audio) {
+			t.Fatalf("GET = %d %q", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("head", func(t *testing.T) {
+		resp, body := request(t, http.MethodHead, url, nil)
+		if resp.StatusCode != http.StatusOK || body != "" {
+			t.Fatalf("HEAD = %d %q", resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(len(audio)) {
+			t.Errorf("Content-Length = %q", got)
+		}
+		if resp.Header.Get("ETag") != etag {
+			t.Errorf("ETag = %q, want %q", resp.Header.Get("ETag"), etag)
+		}
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		resp, _ := request(t, http.MethodGet, url, map[string]string{"If-None-Match": etag})
+		if resp.StatusCode != http.StatusNotModified {
+			t.Errorf("If-None-Match = %d", resp.StatusCode)
+		}
+		resp, _ = request(t, http.MethodGet, url, map[string]string{"If-Modified-Since": lastModified})
+		if resp.StatusCode != http.StatusNotModified {
+			t.Errorf("If-Modified-Since = %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		resp, _ := request(t, http.MethodGet, url+"?download", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET = %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="Episode.mp3"` {
+			t.Errorf("Content-Disposition = %q", got)
+		}
+	})
+}
+
+func TestStreamAudioUnavailable(t *testing.T) {
+	a, srv := newTestServer(t)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		resp, _ := request(t, method, srv.URL+"/audio/"+uuid.NewString(), nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s unknown id = %d, want 404", method, resp.StatusCode)
+		}
+	}
+	resp, _ := request(t, http.MethodGet, srv.URL+"/audio/not-a-uuid", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET invalid id = %d, want 400", resp.StatusCode)
+	}
+
+	for _, status := range []meta.Status{meta.StatusLoading, meta.StatusOnDemand} {
+		video := addTestVideo(t, a, status, nil)
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			resp, _ := request(t, method, srv.URL+"/audio/"+video.ID.String(), map[string]string{"Range": "bytes=0-"})
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("%s %s = %d, want 503", method, status, resp.StatusCode)
+			}
+			if resp.Header.Get("Retry-After") == "" {
+				t.Errorf("%s %s has no Retry-After", method, status)
+			}
+		}
+	}
+}
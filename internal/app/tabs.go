@@ -1,11 +1,18 @@
 package app
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
+	"tubefeed/internal/media"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+	"tubefeed/internal/provider/yt"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // GET /tab/:id
@@ -95,12 +102,232 @@ func (a App) deleteTab(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
-	// TODO: Cleanup Audio Files
+	videos, err := a.Db.LoadDatabase(ctx, id)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
 	err = a.Db.DeleteTab(ctx, id)
 	if err != nil {
 		log.Println(err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 		return
 	}
+	// audio files shared with other tabs stay, the gc collects files
+	// left behind by failures
+	for _, video := range videos {
+		err = a.removeAudio(ctx, video.AudioID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
 	a.tablist(c)
 }
+
+// PATCH /tab/:id/order -- store the manual order of the videos
+func (a App) ordertab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	var ids []uuid.UUID
+	for _, v := range c.PostFormArray("id") {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			log.Println(err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, err)
+			return
+		}
+		ids = append(ids, id)
+	}
+	err = a.Db.SetPositions(ctx, tabid, ids)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	// dragging rows only makes sense for manually sorted tabs
+	settings, err := a.loadTab(ctx, tabid)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	if settings.Sort != meta.SortManual {
+		err = a.Db.SetTabSort(ctx, tabid, meta.SortManual, settings.Serial)
+		if err != nil {
+			log.Println(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// PATCH /tab/:id/sort -- change sort mode and feed type of a tab
+func (a App) sorttab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	mode, err := meta.ParseSortMode(c.PostForm("sort"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	serial := c.PostForm("serial") != ""
+	err = a.Db.SetTabSort(ctx, tabid, mode, serial)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	videometa, err := a.loadVideoMeta(ctx, tabid)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.HTML(http.StatusOK, "video_list.html", gin.H{
+		"Videos": videometa,
+		"tab":    tabid,
+	})
+}
+
+// PATCH /tab/:id/audio -- change the audio profile of new downloads
+func (a App) audiotab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	opts, err := parseAudioOptions(c)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	err = a.Db.SetTabAudio(ctx, tabid, opts)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// parseAudioOptions reads an audio profile from the form, empty numbers
+// keep the defaults
+func parseAudioOptions(c *gin.Context) (provider.AudioOptions, error) {
+	format, err := provider.ParseAudioFormat(c.PostForm("format"))
+	if err != nil {
+		return provider.AudioOptions{}, err
+	}
+	opts := provider.AudioOptions{Format: format}
+	for _, field := range []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"bitrate", &opts.Bitrate, 320},
+		{"channels", &opts.Channels, 2},
+		{"samplerate", &opts.SampleRate, 48000},
+	} {
+		v := c.PostForm(field.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > field.max {
+			return provider.AudioOptions{}, fmt.Errorf("invalid %s: %q", field.name, v)
+		}
+		*field.value = n
+	}
+	return opts, nil
+}
+
+// PATCH /tab/:id/process -- change the post-processing of new downloads
+func (a App) processtab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	speed, err := strconv.ParseFloat(c.DefaultPostForm("speed", "1"), 64)
+	if err != nil || speed < 0.5 || speed > 2 {
+		err = fmt.Errorf("invalid speed: %q", c.PostForm("speed"))
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	pipeline := media.Pipeline{
+		Loudnorm:    c.PostForm("loudnorm") != "",
+		TrimSilence: c.PostForm("trim_silence") != "",
+		Speed:       speed,
+	}
+	err = a.Db.SetTabProcess(ctx, tabid, pipeline)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// PATCH /tab/:id/lazy -- download audio of new videos only when requested
+func (a App) lazytab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	err = a.Db.SetTabLazy(ctx, tabid, c.PostForm("lazy") != "")
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// PATCH /tab/:id/sponsorblock -- change the SponsorBlock categories cut
+// from new downloads
+func (a App) sponsorblocktab(c *gin.Context) {
+	ctx := c.Request.Context()
+	tabid, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	categories := c.PostFormArray("category")
+	for _, category := range categories {
+		if !slices.Contains(yt.SponsorBlockCategories, category) {
+			err = fmt.Errorf("unknown sponsorblock category: %q", category)
+			log.Println(err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, err)
+			return
+		}
+	}
+	err = a.Db.SetTabSponsorBlock(ctx, tabid, categories)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"tubefeed/internal/transcript"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GET /transcript/:id.vtt and /transcript/:id.srt, without extension vtt
+func (a App) transcriptHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	name, ext, _ := strings.Cut(c.Param("id"), ".")
+	if ext == "" {
+		ext = "vtt"
+	}
+	if ext != "vtt" && ext != "srt" {
+		err := fmt.Errorf("unknown transcript format: %q", ext)
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusNotFound, err)
+		return
+	}
+	id, err := uuid.Parse(name)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		return
+	}
+	video, err := a.Db.GetVideo(ctx, id)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusNotFound, err)
+		return
+	}
+	path := filepath.Join(a.config.AudioPath, fmt.Sprintf("%s.%s", video.AudioID, ext))
+	if video.TranscriptLang == "" || !fileExists(path) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"msg": "no transcript"})
+		return
+	}
+	c.Header("Content-Type", transcript.ContentType(ext)+"; charset=utf-8")
+	c.Header("Content-Language", video.TranscriptLang)
+	c.File(path)
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -11,6 +13,49 @@ type Config struct {
 	DbPath      string
 	ExternalURL string
 	Workers     int
+	// FilenamePattern names downloaded files, placeholders are
+	// {channel}, {title}, {date}, {tab} and {id}
+	FilenamePattern string
+	// SponsorBlockAPI is the base url of the SponsorBlock server
+	SponsorBlockAPI string
+	// SubtitleLangs are the subtitle languages to download, in order of
+	// preference, none disables transcripts
+	SubtitleLangs []string
+	// TranscribeCmd transcribes videos without subtitles, {audio},
+	// {output} and {lang} are replaced. Empty disables it.
+	TranscribeCmd     string
+	TranscribeLang    string
+	TranscribeWorkers int
+	// EvictAfter removes audio of lazy tabs not requested for this long,
+	// 0 keeps it
+	EvictAfter time.Duration
+	// JanitorInterval is how often the retention rules of the tabs are
+	// applied, 0 disables them
+	JanitorInterval time.Duration
+	// Quota is the bytes all audio files may use before new episodes are
+	// rejected, 0 is unlimited
+	Quota int64
+	// MinFree is the disk space in bytes a download leaves free
+	MinFree int64
+	// GCInterval is how often orphaned files and stale rows are collected,
+	// also at startup. 0 disables it.
+	GCInterval time.Duration
+	// Storage keeps the published audio files, fs in AudioPath or s3
+	Storage string
+	S3      S3
+}
+
+// S3 is the bucket of the s3 storage
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	// Presign redirects audio requests to urls of the bucket valid this
+	// long, 0 serves the audio through tubefeed
+	Presign time.Duration
 }
 
 func Load() *Config {
@@ -18,12 +63,68 @@ func Load() *Config {
 	if err != nil {
 		panic(err)
 	}
+	transcribeWorkers, err := strconv.Atoi(GetEnvOrDefault("TRANSCRIBE_WORKERS", "1"))
+	if err != nil {
+		panic(err)
+	}
+	evictAfter, err := time.ParseDuration(GetEnvOrDefault("EVICT_AFTER", "168h"))
+	if err != nil {
+		panic(err)
+	}
+	janitorInterval, err := time.ParseDuration(GetEnvOrDefault("JANITOR_INTERVAL", "1h"))
+	if err != nil {
+		panic(err)
+	}
+	quota, err := strconv.ParseInt(GetEnvOrDefault("QUOTA_MB", "0"), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	minFree, err := strconv.ParseInt(GetEnvOrDefault("MIN_FREE_MB", "1024"), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	gcInterval, err := time.ParseDuration(GetEnvOrDefault("GC_INTERVAL", "24h"))
+	if err != nil {
+		panic(err)
+	}
+	pathStyle, err := strconv.ParseBool(GetEnvOrDefault("S3_PATH_STYLE", "true"))
+	if err != nil {
+		panic(err)
+	}
+	presign, err := time.ParseDuration(GetEnvOrDefault("S3_PRESIGN", "0"))
+	if err != nil {
+		panic(err)
+	}
 	return &Config{
 		ListenPort:  GetEnvOrDefault("LISTEN_PORT", "8091"),
 		AudioPath:   GetEnvOrDefault("AUDIO_PATH", "./audio/"),
 		DbPath:      "./config/tubefeed.db",
 		ExternalURL: GetEnvOrDefault("EXTERNAL_URL", "localhost"),
 		Workers:     workers,
+
+		FilenamePattern: GetEnvOrDefault("FILENAME_PATTERN", "{channel} - {title}"),
+		SponsorBlockAPI: GetEnvOrDefault("SPONSORBLOCK_API", "https://sponsor.ajay.app"),
+		SubtitleLangs:   strings.FieldsFunc(GetEnvOrDefault("SUBTITLE_LANGS", "en"), isListSeparator),
+
+		TranscribeCmd:     GetEnvOrDefault("TRANSCRIBE_CMD", ""),
+		TranscribeLang:    GetEnvOrDefault("TRANSCRIBE_LANG", "en"),
+		TranscribeWorkers: transcribeWorkers,
+		EvictAfter:        evictAfter,
+		JanitorInterval:   janitorInterval,
+		Quota:             quota << 20,
+		MinFree:           minFree << 20,
+		GCInterval:        gcInterval,
+
+		Storage: GetEnvOrDefault("STORAGE", "fs"),
+		S3: S3{
+			Endpoint:  GetEnvOrDefault("S3_ENDPOINT", ""),
+			Region:    GetEnvOrDefault("S3_REGION", "us-east-1"),
+			Bucket:    GetEnvOrDefault("S3_BUCKET", ""),
+			AccessKey: GetEnvOrDefault("S3_ACCESS_KEY", ""),
+			SecretKey: GetEnvOrDefault("S3_SECRET_KEY", ""),
+			PathStyle: pathStyle,
+			Presign:   presign,
+		},
 	}
 }
 
@@ -33,3 +134,8 @@ func GetEnvOrDefault(key, def string) string {
 	}
 	return def
 }
+
+// isListSeparator splits comma or space separated lists
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' '
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"tubefeed/internal/sqlc"
+)
+
+// columns added after a table was first created. CREATE TABLE IF NOT EXISTS
+// in the schema leaves existing tables untouched, so older databases get
+// them added here.
+var migrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"videos", "audio_id", "TEXT"},
+	{"videos", "position", "INTEGER NOT NULL DEFAULT 0"},
+	{"videos", "added_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"videos", "upload_date", "INTEGER"},
+	{"videos", "played", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"videos", "description", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "thumbnail", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "tags", "TEXT NOT NULL DEFAULT '[]'"},
+	{"videos", "categories", "TEXT NOT NULL DEFAULT '[]'"},
+	{"videos", "view_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"videos", "audio_ext", "TEXT NOT NULL DEFAULT 'mp3'"},
+	{"videos", "processing", "TEXT NOT NULL DEFAULT '[]'"},
+	{"videos", "tempo", "REAL NOT NULL DEFAULT 1"},
+	{"videos", "cut_segments", "TEXT NOT NULL DEFAULT '[]'"},
+	{"videos", "split_chapters", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"videos", "parent_id", "TEXT"},
+	{"videos", "transcript", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "transcript_lang", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "accessed_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"videos", "trimmed_ms", "INTEGER NOT NULL DEFAULT 0"},
+	{"tabs", "sort", "TEXT NOT NULL DEFAULT 'manual'"},
+	{"tabs", "serial", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"tabs", "audio_format", "TEXT NOT NULL DEFAULT 'mp3'"},
+	{"tabs", "audio_bitrate", "INTEGER NOT NULL DEFAULT 0"},
+	{"tabs", "audio_channels", "INTEGER NOT NULL DEFAULT 0"},
+	{"tabs", "audio_samplerate", "INTEGER NOT NULL DEFAULT 0"},
+	{"tabs", "loudnorm", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"tabs", "trim_silence", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"tabs", "speed", "REAL NOT NULL DEFAULT 1"},
+	{"tabs", "sponsorblock", "TEXT NOT NULL DEFAULT '[]'"},
+	{"tabs", "lazy", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"tabs", "keep_last", "INTEGER NOT NULL DEFAULT 0"},
+	{"tabs", "keep_days", "INTEGER NOT NULL DEFAULT 0"},
+	{"tabs", "keep_unplayed", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"tabs", "max_size", "INTEGER NOT NULL DEFAULT 0"},
+	{"tabs", "quota", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+func migrate(sqlite *sql.DB) error {
+	for _, m := range migrations {
+		var count int
+		err := sqlite.QueryRow(
+			"SELECT count(*) FROM pragma_table_info(?) WHERE name = ?",
+			m.table, m.column,
+		).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		_, err = sqlite.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition))
+		if err != nil {
+			return fmt.Errorf("migrate %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+// searchVersion is stored as user_version once the search index is built.
+// Increase it when sqlc.SearchSchema changes.
+const searchVersion = 3
+
+// setupSearch creates the full text search index. It needs sqlite built
+// with fts5, without it search falls back to scanning all videos. The index
+// is only rebuilt when its version changed.
+func setupSearch(sqlite *sql.DB) bool {
+	var version int
+	err := sqlite.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		log.Printf("full text search disabled: %v", err)
+		return false
+	}
+	if version != searchVersion {
+		// recreating the index picks up columns added to it
+		dropSearch(sqlite)
+	}
+	_, err = sqlite.Exec(sqlc.SearchSchema)
+	switch {
+	case err != nil:
+	case version != searchVersion:
+		// the index only follows changes, pick up rows from before it existed
+		_, err = sqlite.Exec("INSERT INTO videos_fts(videos_fts) VALUES('rebuild')")
+		if err == nil {
+			_, err = sqlite.Exec(fmt.Sprintf("PRAGMA user_version = %d", searchVersion))
+		}
+	default:
+		// the existing index can't be read without fts5
+		_, err = sqlite.Exec("SELECT rowid FROM videos_fts LIMIT 1")
+	}
+	if err != nil {
+		log.Printf("full text search disabled: %v", err)
+		// triggers left by a build with fts5 would make every write fail
+		dropSearch(sqlite)
+		// rows change without the triggers, the next build with fts5 rebuilds
+		_, _ = sqlite.Exec("PRAGMA user_version = 0")
+		return false
+	}
+	return true
+}
+
+// dropSearch removes the search index and its triggers
+func dropSearch(sqlite *sql.DB) {
+	for _, trigger := range []string{"videos_fts_insert", "videos_fts_delete", "videos_fts_update"} {
+		_, err := sqlite.Exec("DROP TRIGGER IF EXISTS " + trigger)
+		if err != nil {
+			log.Printf("drop trigger %s: %v", trigger, err)
+		}
+	}
+	// fails without fts5, the table is unused then
+	_, _ = sqlite.Exec("DROP TABLE IF EXISTS videos_fts")
+}
@@ -3,9 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
+	"tubefeed/internal/media"
 	"tubefeed/internal/meta"
 	"tubefeed/internal/provider"
 
@@ -20,12 +24,16 @@ func dbErr(s any) error {
 	return fmt.Errorf("%w: %v", ErrDatabase, s)
 }
 
+var ErrNotFound = errors.New("not found")
+
 type Database struct {
 	queries *sqlc.Queries
+	sqlite  *sql.DB
+	fts     bool // full text search index available
 }
 
 func NewDatabase(path string) (db *Database, close func(), err error) {
-	sqlite, err := sql.Open("sqlite3", path)
+	sqlite, err := sql.Open("sqlite3", dsn(path))
 	if err != nil {
 		return nil, nil, dbErr(err)
 	}
@@ -33,80 +41,320 @@ func NewDatabase(path string) (db *Database, close func(), err error) {
 	if err != nil {
 		return nil, nil, dbErr(err)
 	}
+	err = migrate(sqlite)
+	if err != nil {
+		return nil, nil, dbErr(err)
+	}
 	return &Database{
 		queries: sqlc.New(sqlite),
+		sqlite:  sqlite,
+		fts:     setupSearch(sqlite),
 	}, func() { _ = sqlite.Close() }, nil
 }
 
-// Fetches all video providers from the database
+// dsn is the uri of the database file path. Workers and requests write
+// concurrently, so transactions take the write lock up front and wait for
+// other connections instead of failing with SQLITE_BUSY.
+func dsn(path string) string {
+	file := url.URL{Path: path}
+	return "file:" + file.EscapedPath() + "?_busy_timeout=5000&_txlock=immediate"
+}
+
+// WithTx runs fn inside a transaction. The Database passed to fn uses the
+// transaction, it is committed when fn returns nil and rolled back otherwise.
+func (db *Database) WithTx(ctx context.Context, fn func(tx *Database) error) error {
+	tx, err := db.sqlite.BeginTx(ctx, nil)
+	if err != nil {
+		return dbErr(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	err = fn(&Database{queries: db.queries.WithTx(tx), sqlite: db.sqlite, fts: db.fts})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// Fetches all video providers of tab from the database with their chapters
 func (db *Database) LoadDatabase(ctx context.Context, tab int) ([]meta.Video, error) {
 	rows, err := db.queries.LoadDatabase(ctx, sql.NullInt64{Int64: int64(tab), Valid: true})
 	if err != nil {
 		return nil, dbErr(err)
 	}
+	chapters, err := db.queries.GetTabChapters(ctx, sql.NullInt64{Int64: int64(tab), Valid: true})
+	if err != nil {
+		return nil, dbErr(err)
+	}
+	byAudio := make(map[string][]provider.Chapter)
+	for _, row := range chapters {
+		byAudio[row.AudioID] = append(byAudio[row.AudioID], chapterFromRow(row))
+	}
 	var videos []meta.Video
 	for _, row := range rows {
-		videomd := provider.VideoMeta{
-			Length:      time.Duration(row.Length) * time.Second,
-			URL:         row.Url,
-			Channel:     row.Channel,
-			Title:       row.Title,
-			Description: "",
-		}
-		video := meta.Video{
-			ID:     uuid.MustParse(row.Uuid),
-			Meta:   videomd,
-			Status: meta.Status(row.Status),
-		}
+		video := videoFromRow(row)
+		video.Meta.Chapters = byAudio[video.AudioID.String()]
 		videos = append(videos, video)
 	}
 
 	return videos, nil
 }
 
+// Search returns the videos of all tabs matching query in title, channel,
+// description or transcript, newest first
+func (db *Database) Search(ctx context.Context, query string) ([]meta.Video, error) {
+	var rows []sqlc.Video
+	var err error
+	if strings.TrimSpace(query) == "" || !db.fts {
+		rows, err = db.queries.AllVideos(ctx)
+	} else {
+		rows, err = db.queries.SearchVideos(ctx, ftsQuery(query))
+	}
+	if err != nil {
+		return nil, dbErr(err)
+	}
+	var videos []meta.Video
+	for _, row := range rows {
+		if !db.fts && !containsWords(row, query) {
+			continue
+		}
+		videos = append(videos, videoFromRow(row))
+	}
+	return videos, nil
+}
+
+// AllVideos returns the videos of all tabs
+func (db *Database) AllVideos(ctx context.Context) ([]meta.Video, error) {
+	rows, err := db.queries.AllVideos(ctx)
+	if err != nil {
+		return nil, dbErr(err)
+	}
+	videos := make([]meta.Video, 0, len(rows))
+	for _, row := range rows {
+		videos = append(videos, videoFromRow(row))
+	}
+	return videos, nil
+}
+
+// containsWords is the search without full text index, it looks at the
+// same columns as the index
+func containsWords(row sqlc.Video, query string) bool {
+	text := strings.ToLower(strings.Join([]string{row.Title, row.Channel, row.Description, row.Transcript}, " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// ftsQuery turns user input into a fts5 query matching all words as
+// prefixes. Quoting every word keeps fts5 syntax out of user input.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
 func (db *Database) GetVideo(ctx context.Context, id uuid.UUID) (meta.Video, error) {
 
 	row, err := db.queries.GetVideo(ctx, id.String())
+	if errors.Is(err, sql.ErrNoRows) {
+		return meta.Video{}, fmt.Errorf("%w: video %s", ErrNotFound, id)
+	}
 	if err != nil {
 		return meta.Video{}, dbErr(err)
 	}
+	video := videoFromRow(row)
+	video.Meta.Chapters, err = db.Chapters(ctx, video.AudioID)
+	if err != nil {
+		return meta.Video{}, err
+	}
+	return video, nil
+}
 
-	videomd := provider.VideoMeta{
+// Children returns the chapter episodes split from video id
+func (db *Database) Children(ctx context.Context, id uuid.UUID) ([]meta.Video, error) {
+	rows, err := db.queries.GetChildren(ctx, sql.NullString{String: id.String(), Valid: true})
+	if err != nil {
+		return nil, dbErr(err)
+	}
+	var videos []meta.Video
+	for _, row := range rows {
+		videos = append(videos, videoFromRow(row))
+	}
+	return videos, nil
+}
+
+// Chapters returns the chapters of the audio file audioID in order
+func (db *Database) Chapters(ctx context.Context, audioID uuid.UUID) ([]provider.Chapter, error) {
+	rows, err := db.queries.GetChapters(ctx, audioID.String())
+	if err != nil {
+		return nil, dbErr(err)
+	}
+	var chapters []provider.Chapter
+	for _, row := range rows {
+		chapters = append(chapters, chapterFromRow(row))
+	}
+	return chapters, nil
+}
 
-		Title:   row.Title,
-		Length:  time.Duration(row.Length) * time.Second,
-		Channel: row.Channel,
-		URL:     row.Url,
+func chapterFromRow(row sqlc.Chapter) provider.Chapter {
+	return provider.Chapter{
+		Start: time.Duration(row.StartMs) * time.Millisecond,
+		End:   time.Duration(row.EndMs) * time.Millisecond,
+		Title: row.Title,
+	}
+}
+
+// DeleteChapters removes the chapters of the audio file audioID
+func (db *Database) DeleteChapters(ctx context.Context, audioID uuid.UUID) error {
+	err := db.queries.DeleteChapters(ctx, audioID.String())
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+func videoFromRow(row sqlc.Video) meta.Video {
+	videomd := provider.VideoMeta{
+		Title:       row.Title,
+		Length:      time.Duration(row.Length) * time.Second,
+		Channel:     row.Channel,
+		URL:         row.Url,
+		Description: row.Description,
+		ProviderID:  row.ProviderID.String,
+		Thumbnail:   row.Thumbnail,
+		Tags:        jsonList(row.Tags),
+		Categories:  jsonList(row.Categories),
+		ViewCount:   row.ViewCount,
+	}
+	if row.UploadDate.Valid {
+		videomd.UploadDate = time.Unix(row.UploadDate.Int64, 0)
 	}
 
+	id := uuid.MustParse(row.Uuid)
 	video := meta.Video{
-		ID:     id,
-		Meta:   videomd,
-		Status: meta.Status(row.Status),
+		ID:       id,
+		Tabid:    int(row.Tabid.Int64),
+		AudioID:  audioID(id, row.AudioID),
+		Ext:      row.AudioExt,
+		Tempo:    row.Tempo,
+		Trimmed:  time.Duration(row.TrimmedMs) * time.Millisecond,
+		Meta:     videomd,
+		Status:   meta.Status(row.Status),
+		Position: int(row.Position),
+		Played:   row.Played,
+	}
+	if row.AddedAt > 0 {
+		video.Added = time.Unix(row.AddedAt, 0)
 	}
+	_ = json.Unmarshal([]byte(row.Processing), &video.Processing)
+	_ = json.Unmarshal([]byte(row.CutSegments), &video.Cut)
+	video.Split = row.SplitChapters
+	video.TranscriptLang = row.TranscriptLang
+	video.Size = row.Size.Int64
+	if row.ParentID.Valid {
+		video.ParentID, _ = uuid.Parse(row.ParentID.String)
+	}
+	return video
+}
 
-	return video, nil
+// jsonList decodes a json array column, broken values read as empty
+func jsonList(s string) []string {
+	var list []string
+	_ = json.Unmarshal([]byte(s), &list)
+	return list
 }
 
-// Saves video metadata to the database
+// Saves video metadata to the database. New videos are appended to the
+// manual order of the tab. The chapters replace those stored for the audio
+// file of the video.
 func (db *Database) SaveVideoMetadata(ctx context.Context, video meta.Video, tabid int, status meta.Status) error {
-	err := db.queries.SaveMetadata(
+	return db.WithTx(ctx, func(tx *Database) error {
+		return tx.saveVideoMetadata(ctx, video, tabid, status)
+	})
+}
+
+func (db *Database) saveVideoMetadata(ctx context.Context, video meta.Video, tabid int, status meta.Status) error {
+	position, err := db.queries.NextPosition(ctx, sql.NullInt64{Int64: int64(tabid), Valid: true})
+	if err != nil {
+		return dbErr(err)
+	}
+	var uploadDate sql.NullInt64
+	if !video.Meta.UploadDate.IsZero() {
+		uploadDate = sql.NullInt64{Int64: video.Meta.UploadDate.Unix(), Valid: true}
+	}
+	added := video.Added
+	if added.IsZero() {
+		added = time.Now()
+	}
+	tags, err := json.Marshal(nonNil(video.Meta.Tags))
+	if err != nil {
+		return dbErr(err)
+	}
+	categories, err := json.Marshal(nonNil(video.Meta.Categories))
+	if err != nil {
+		return dbErr(err)
+	}
+	err = db.queries.SaveMetadata(
 		ctx,
 		sqlc.SaveMetadataParams{
-			Uuid:    video.ID.String(),
-			Title:   video.Meta.Title,
-			Channel: video.Meta.Channel,
-			Length:  int64(video.Meta.Length.Seconds()),
-			Url:     video.Meta.URL,
-			Tabid:   sql.NullInt64{Int64: int64(tabid), Valid: true},
-			Status:  string(status),
+			Uuid:        video.ID.String(),
+			Title:       video.Meta.Title,
+			Channel:     video.Meta.Channel,
+			Length:      int64(video.Meta.Length.Seconds()),
+			Url:         video.Meta.URL,
+			Tabid:       sql.NullInt64{Int64: int64(tabid), Valid: true},
+			Status:      string(status),
+			UploadDate:  uploadDate,
+			AddedAt:     added.Unix(),
+			Position:    position,
+			Description: video.Meta.Description,
+			ProviderID:  sql.NullString{String: video.Meta.ProviderID, Valid: video.Meta.ProviderID != ""},
+			Thumbnail:   video.Meta.Thumbnail,
+			Tags:        string(tags),
+			Categories:  string(categories),
+			ViewCount:   video.Meta.ViewCount,
+
+			SplitChapters: video.Split,
+			ParentID:      sql.NullString{String: video.ParentID.String(), Valid: video.ParentID != uuid.Nil},
 		})
 	if err != nil {
 		return dbErr(err)
 	}
+
+	err = db.queries.DeleteChapters(ctx, video.AudioID.String())
+	if err != nil {
+		return dbErr(err)
+	}
+	for _, ch := range video.Meta.Chapters {
+		err = db.queries.AddChapter(ctx, sqlc.AddChapterParams{
+			AudioID: video.AudioID.String(),
+			StartMs: ch.Start.Milliseconds(),
+			EndMs:   ch.End.Milliseconds(),
+			Title:   ch.Title,
+		})
+		if err != nil {
+			return dbErr(err)
+		}
+	}
 	return nil
 }
 
+// nonNil keeps empty lists encoded as [] instead of null
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
 func (db *Database) CheckforDuplicate(ctx context.Context, video meta.Video, tabid int) (bool, error) {
 
 	count, err := db.queries.CountDuplicate(
@@ -133,6 +381,94 @@ func (db *Database) DeleteVideo(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// MoveVideo moves a video to the end of another tab
+func (db *Database) MoveVideo(ctx context.Context, id uuid.UUID, tabid int) error {
+	position, err := db.queries.NextPosition(ctx, sql.NullInt64{Int64: int64(tabid), Valid: true})
+	if err != nil {
+		return dbErr(err)
+	}
+	err = db.queries.MoveVideo(
+		ctx,
+		sqlc.MoveVideoParams{
+			Tabid:    sql.NullInt64{Int64: int64(tabid), Valid: true},
+			Position: position,
+			Uuid:     id.String(),
+		})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// CopyVideo copies a video to another tab. The copy gets a new id but
+// references the audio file of the original.
+func (db *Database) CopyVideo(ctx context.Context, id uuid.UUID, tabid int) (uuid.UUID, error) {
+	position, err := db.queries.NextPosition(ctx, sql.NullInt64{Int64: int64(tabid), Valid: true})
+	if err != nil {
+		return uuid.Nil, dbErr(err)
+	}
+	newid := uuid.New()
+	err = db.queries.CopyVideo(
+		ctx,
+		sqlc.CopyVideoParams{
+			NewUuid:  newid.String(),
+			Tabid:    int64(tabid),
+			Position: position,
+			AddedAt:  time.Now().Unix(),
+			Uuid:     id.String(),
+		})
+	if err != nil {
+		return uuid.Nil, dbErr(err)
+	}
+	return newid, nil
+}
+
+// SetPositions stores the manual order of the videos in tab
+func (db *Database) SetPositions(ctx context.Context, tabid int, ids []uuid.UUID) error {
+	return db.WithTx(ctx, func(tx *Database) error {
+		for i, id := range ids {
+			err := tx.queries.SetPosition(
+				ctx,
+				sqlc.SetPositionParams{
+					Position: int64(i + 1),
+					Uuid:     id.String(),
+					Tabid:    sql.NullInt64{Int64: int64(tabid), Valid: true},
+				})
+			if err != nil {
+				return dbErr(err)
+			}
+		}
+		return nil
+	})
+}
+
+func (db *Database) SetPlayed(ctx context.Context, id uuid.UUID, played bool) error {
+	err := db.queries.SetPlayed(
+		ctx,
+		sqlc.SetPlayedParams{
+			Played: played,
+			Uuid:   id.String(),
+		})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// AudioReferences counts the videos using the audio file audioID
+func (db *Database) AudioReferences(ctx context.Context, audioID uuid.UUID) (int, error) {
+	count, err := db.queries.CountAudioReferences(
+		ctx,
+		sqlc.CountAudioReferencesParams{
+			Uuid:    audioID.String(),
+			AudioID: sql.NullString{String: audioID.String(), Valid: true},
+		})
+	if err != nil {
+		return 0, dbErr(err)
+	}
+	return int(count), nil
+}
+
 func (db *Database) LoadTabs(ctx context.Context) (map[int]string, error) {
 	rows, err := db.queries.LoadTabs(ctx)
 	if err != nil {
@@ -144,6 +480,142 @@ func (db *Database) LoadTabs(ctx context.Context) (map[int]string, error) {
 	}
 	return tabs, nil
 }
+
+// GetTab returns the settings of tab id
+func (db *Database) GetTab(ctx context.Context, id int) (meta.Tab, error) {
+	row, err := db.queries.GetTab(ctx, int64(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return meta.Tab{}, fmt.Errorf("%w: tab %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return meta.Tab{}, dbErr(err)
+	}
+	tab := meta.Tab{
+		ID:     int(row.ID),
+		Name:   row.Name,
+		Sort:   meta.SortMode(row.Sort),
+		Serial: row.Serial,
+		Audio: provider.AudioOptions{
+			Format:     provider.AudioFormat(row.AudioFormat),
+			Bitrate:    int(row.AudioBitrate),
+			Channels:   int(row.AudioChannels),
+			SampleRate: int(row.AudioSamplerate),
+		},
+		Process: media.Pipeline{
+			Loudnorm:    row.Loudnorm,
+			TrimSilence: row.TrimSilence,
+			Speed:       row.Speed,
+		},
+	}
+	tab.Audio.RemoveCategories = jsonList(row.Sponsorblock)
+	tab.Lazy = row.Lazy
+	tab.Retention = meta.Retention{
+		KeepLast:     int(row.KeepLast),
+		MaxAge:       time.Duration(row.KeepDays) * 24 * time.Hour,
+		KeepUnplayed: row.KeepUnplayed,
+		MaxSize:      row.MaxSize << 20,
+	}
+	tab.Quota = row.Quota << 20
+	return tab, nil
+}
+
+// SetTabQuota changes the bytes of audio tab id may use, 0 is unlimited
+func (db *Database) SetTabQuota(ctx context.Context, id int, quota int64) error {
+	err := db.queries.SetTabQuota(ctx, sqlc.SetTabQuotaParams{Quota: quota >> 20, ID: int64(id)})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// SetTabRetention changes the rules expiring old episodes of tab id
+func (db *Database) SetTabRetention(ctx context.Context, id int, r meta.Retention) error {
+	err := db.queries.SetTabRetention(ctx, sqlc.SetTabRetentionParams{
+		KeepLast:     int64(r.KeepLast),
+		KeepDays:     int64(r.MaxAge / (24 * time.Hour)),
+		KeepUnplayed: r.KeepUnplayed,
+		MaxSize:      r.MaxSize >> 20,
+		ID:           int64(id),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// SetTabLazy changes whether tab id only downloads audio on request
+func (db *Database) SetTabLazy(ctx context.Context, id int, lazy bool) error {
+	err := db.queries.SetTabLazy(ctx, sqlc.SetTabLazyParams{Lazy: lazy, ID: int64(id)})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// SetTabSponsorBlock changes the SponsorBlock categories removed from new
+// downloads of tab id
+func (db *Database) SetTabSponsorBlock(ctx context.Context, id int, categories []string) error {
+	list, err := json.Marshal(nonNil(categories))
+	if err != nil {
+		return dbErr(err)
+	}
+	err = db.queries.SetTabSponsorBlock(ctx, sqlc.SetTabSponsorBlockParams{
+		Sponsorblock: string(list),
+		ID:           int64(id),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// SetTabProcess changes the post-processing of new downloads of tab id
+func (db *Database) SetTabProcess(ctx context.Context, id int, p media.Pipeline) error {
+	err := db.queries.SetTabProcess(
+		ctx,
+		sqlc.SetTabProcessParams{
+			Loudnorm:    p.Loudnorm,
+			TrimSilence: p.TrimSilence,
+			Speed:       p.Speed,
+			ID:          int64(id),
+		})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// SetTabAudio changes the audio profile used for new downloads of tab id
+func (db *Database) SetTabAudio(ctx context.Context, id int, opts provider.AudioOptions) error {
+	err := db.queries.SetTabAudio(
+		ctx,
+		sqlc.SetTabAudioParams{
+			AudioFormat:     string(opts.Format),
+			AudioBitrate:    int64(opts.Bitrate),
+			AudioChannels:   int64(opts.Channels),
+			AudioSamplerate: int64(opts.SampleRate),
+			ID:              int64(id),
+		})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+func (db *Database) SetTabSort(ctx context.Context, id int, sort meta.SortMode, serial bool) error {
+	err := db.queries.SetTabSort(
+		ctx,
+		sqlc.SetTabSortParams{
+			Sort:   string(sort),
+			Serial: serial,
+			ID:     int64(id),
+		})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
 func (db *Database) ChangeTabName(ctx context.Context, id int, name string) error {
 	err := db.queries.ChangeTabName(
 		ctx,
@@ -193,6 +665,155 @@ func (db *Database) DeleteTab(ctx context.Context, id int) error {
 	return nil
 }
 
+// SetAudioFile records the extension and the cut segments of the audio
+// file audioID for all videos sharing it
+func (db *Database) SetAudioFile(ctx context.Context, audioID uuid.UUID, file provider.AudioFile) error {
+	cut, err := json.Marshal(nonNilSegments(file.Cut))
+	if err != nil {
+		return dbErr(err)
+	}
+	err = db.queries.SetAudioFile(ctx, sqlc.SetAudioFileParams{
+		AudioExt:    file.Ext,
+		CutSegments: string(cut),
+		AudioID:     audioID.String(),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// nonNilSegments keeps empty lists encoded as [] instead of null
+func nonNilSegments(segments []provider.Segment) []provider.Segment {
+	if segments == nil {
+		return []provider.Segment{}
+	}
+	return segments
+}
+
+// SetProcessing records the post-processing outcomes of the audio file
+// audioID for all videos sharing it
+func (db *Database) SetProcessing(ctx context.Context, audioID uuid.UUID, outcomes []media.Outcome) error {
+	processing, err := json.Marshal(outcomes)
+	if err != nil {
+		return dbErr(err)
+	}
+	err = db.queries.SetProcessing(ctx, sqlc.SetProcessingParams{
+		Processing: string(processing),
+		Tempo:      media.Tempo(outcomes),
+		TrimmedMs:  media.Trimmed(outcomes).Milliseconds(),
+		AudioID:    audioID.String(),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// SetTranscript records the transcript of the audio file audioID for all
+// videos sharing it
+func (db *Database) SetTranscript(ctx context.Context, audioID uuid.UUID, lang, text string) error {
+	err := db.queries.SetTranscript(ctx, sqlc.SetTranscriptParams{
+		Transcript:     text,
+		TranscriptLang: lang,
+		AudioID:        audioID.String(),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// TouchAudio records that the audio file audioID was requested at t
+func (db *Database) TouchAudio(ctx context.Context, audioID uuid.UUID, t time.Time) error {
+	err := db.queries.TouchAudio(ctx, sqlc.TouchAudioParams{
+		AccessedAt: t.Unix(),
+		AudioID:    audioID.String(),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// SetAudioSize records the bytes of audio file audioID, 0 if it is gone
+func (db *Database) SetAudioSize(ctx context.Context, audioID uuid.UUID, size int64) error {
+	err := db.queries.SetAudioSize(ctx, sqlc.SetAudioSizeParams{
+		Size:    sql.NullInt64{Int64: size, Valid: true},
+		AudioID: audioID.String(),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
+// Usage is the disk space used by the audio files of a tab
+type Usage struct {
+	Files int   // audio files, copies within the tab count once
+	Bytes int64 // recorded size of the files
+}
+
+// TabUsage returns the usage of the tabs by tab id
+func (db *Database) TabUsage(ctx context.Context) (map[int]Usage, error) {
+	rows, err := db.queries.GetTabUsage(ctx)
+	if err != nil {
+		return nil, dbErr(err)
+	}
+	usage := make(map[int]Usage, len(rows))
+	for _, row := range rows {
+		usage[int(row.Tabid)] = Usage{Files: int(row.Files), Bytes: row.Bytes}
+	}
+	return usage, nil
+}
+
+// TotalUsage returns the bytes of all audio files, files shared by tabs
+// count once
+func (db *Database) TotalUsage(ctx context.Context) (int64, error) {
+	bytes, err := db.queries.GetTotalUsage(ctx)
+	if err != nil {
+		return 0, dbErr(err)
+	}
+	return bytes, nil
+}
+
+// IdleAudio is a downloaded audio file of lazy tabs
+type IdleAudio struct {
+	AudioID uuid.UUID
+	Ext     string
+}
+
+// IdleAudio returns the audio files only used in lazy tabs which were
+// not requested since before
+func (db *Database) IdleAudio(ctx context.Context, before time.Time) ([]IdleAudio, error) {
+	rows, err := db.queries.GetIdleAudio(ctx, before.Unix())
+	if err != nil {
+		return nil, dbErr(err)
+	}
+	var idle []IdleAudio
+	for _, row := range rows {
+		id, err := uuid.Parse(row.AudioID)
+		if err != nil {
+			return nil, dbErr(err)
+		}
+		idle = append(idle, IdleAudio{AudioID: id, Ext: row.AudioExt})
+	}
+	return idle, nil
+}
+
+// SetAudioStatus changes the status of all videos sharing audio file
+// audioID
+func (db *Database) SetAudioStatus(ctx context.Context, audioID uuid.UUID, status meta.Status) error {
+	err := db.queries.SetAudioStatus(ctx, sqlc.SetAudioStatusParams{
+		Status:  string(status),
+		AudioID: audioID.String(),
+	})
+	if err != nil {
+		return dbErr(err)
+	}
+	return nil
+}
+
 func (db *Database) SetStatus(ctx context.Context, id uuid.UUID, status meta.Status) error {
 	err := db.queries.SetStatus(
 		ctx,
@@ -206,3 +827,16 @@ func (db *Database) SetStatus(ctx context.Context, id uuid.UUID, status meta.Sta
 	}
 	return nil
 }
+
+// audioID returns the id of the audio file, which is the video id unless
+// the video is a copy
+func audioID(id uuid.UUID, audioID sql.NullString) uuid.UUID {
+	if !audioID.Valid {
+		return id
+	}
+	aid, err := uuid.Parse(audioID.String)
+	if err != nil {
+		return id
+	}
+	return aid
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+
+	"github.com/google/uuid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFtsQuery(t *testing.T) {
+	cases := map[string]string{
+		"talk":              `"talk"*`,
+		"  go   talk ":      `"go"* "talk"*`,
+		`say "hi" (NEAR)-x`: `"say"* """hi"""* "(NEAR)-x"*`,
+	}
+
+	for k, v := range cases {
+		if got := ftsQuery(k); got != v {
+			t.Errorf("ftsQuery does not match: %s != %s", got, v)
+		}
+	}
+}
+
+func TestNewDatabasePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a?b#c%20d.db")
+	_, closedb, err := NewDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedb()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("database not created at %s: %v", path, err)
+	}
+}
+
+func TestSetupSearchVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tubefeed.db")
+	for range 2 {
+		db, closedb, err := NewDatabase(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var version int
+		err = db.sqlite.QueryRow("PRAGMA user_version").Scan(&version)
+		closedb()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if db.fts {
+			want = searchVersion
+		}
+		if version != want {
+			t.Errorf("user_version = %d, want %d", version, want)
+		}
+	}
+}
+
+// addVideos saves videos with the metadata meta to tab 1
+func addVideos(t *testing.T, db *Database, metas ...provider.VideoMeta) []meta.Video {
+	t.Helper()
+	var videos []meta.Video
+	for _, md := range metas {
+		id := uuid.New()
+		video := meta.Video{ID: id, AudioID: id, Ext: "mp3", Meta: md}
+		err := db.SaveVideoMetadata(context.Background(), video, 1, meta.StatusReady)
+		if err != nil {
+			t.Fatal(err)
+		}
+		videos = append(videos, video)
+	}
+	return videos
+}
+
+func TestSearch(t *testing.T) {
+	db, closedb, err := NewDatabase(filepath.Join(t.TempDir(), "tubefeed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closedb()
+	videos := addVideos(t, db,
+		provider.VideoMeta{Title: "Learning Golang", Channel: "Gophers", Description: "concurrency patterns", URL: "https://example.com/a"},
+		provider.VideoMeta{Title: "Cooking pasta", Channel: "Chef", Description: "italian food", URL: "https://example.com/b"},
+	)
+	golang, pasta := videos[0].ID, videos[1].ID
+	err = db.SetTranscript(context.Background(), videos[1].AudioID, "it", "Boil the spaghetti in salted water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]uuid.UUID{
+		"":                    {golang, pasta},
+		"golang":              {golang},
+		"GOPHERS concurrency": {golang},
+		"gol":                 {golang},
+		"pasta italian":       {pasta},
+		"golang pasta":        nil,
+		"salted spaghetti":    {pasta},
+		"missing":             nil,
+	}
+
+	paths := []bool{false}
+	if db.fts {
+		paths = append(paths, true)
+	} else {
+		t.Log("built without sqlite_fts5, only testing the fallback")
+	}
+	for _, fts := range paths {
+		db.fts = fts
+		for query, want := range cases {
+			found, err := db.Search(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uuid.UUID
+			for _, video := range found {
+				got = append(got, video.ID)
+			}
+			slices.SortFunc(got, compareUUID)
+			slices.SortFunc(want, compareUUID)
+			if !slices.Equal(got, want) {
+				t.Errorf("fts %v: Search(%q) = %v, want %v", fts, query, got, want)
+			}
+		}
+	}
+}
+
+func compareUUID(a, b uuid.UUID) int {
+	return strings.Compare(a.String(), b.String())
+}
@@ -0,0 +1,212 @@
+// Package gc reconciles the audio directory with the videos table
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"tubefeed/internal/db"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// CacheDir is the directory in the audio path yt-dlp keeps its temporary
+// files in
+const CacheDir = ".cache"
+
+// Options of a collection
+type Options struct {
+	DryRun bool // only report what would be done
+	// MinAge leaves younger files alone, a download may still be writing
+	// them
+	MinAge time.Duration
+}
+
+// Report is what a collection did, or would do on a dry run
+type Report struct {
+	Orphans []string    // files of no video
+	Temp    []string    // leftovers of interrupted downloads and processing
+	Freed   int64       // bytes of the removed files
+	Missing []uuid.UUID // audio flagged as failed because its file is gone
+	Sized   int         // audio files whose size was recorded
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%d orphaned and %d temporary files removed (%d MB), %d missing audio files flagged, %d sizes recorded",
+		len(r.Orphans), len(r.Temp), r.Freed>>20, len(r.Missing), r.Sized)
+}
+
+// audio are the videos sharing an audio file
+type audio struct {
+	ext     string
+	size    int64
+	ready   bool // a video is Available
+	loading bool // a video is Downloading
+}
+
+// Collect removes the files in path, its cache and store which belong to
+// no video and the leftovers of interrupted downloads in path, flags
+// Available videos whose audio file is missing in store and records the
+// sizes of the audio files.
+func Collect(ctx context.Context, database *db.Database, path string, store storage.Storage, opts Options) (Report, error) {
+	var r Report
+	videos, err := database.AllVideos(ctx)
+	if err != nil {
+		return r, err
+	}
+	audios := make(map[uuid.UUID]*audio)
+	for _, video := range videos {
+		a, ok := audios[video.AudioID]
+		if !ok {
+			a = &audio{ext: video.Ext, size: video.Size}
+			audios[video.AudioID] = a
+		}
+		a.ready = a.ready || video.Status == meta.StatusReady
+		a.loading = a.loading || video.Status == meta.StatusLoading
+	}
+
+	c := collector{report: &r, opts: opts, now: time.Now()}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return r, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		id, ok := audioID(entry.Name())
+		if !ok {
+			// not ours
+			continue
+		}
+		a, known := audios[id]
+		switch {
+		case !known:
+			c.remove(path, entry, &r.Orphans)
+		case isTemp(entry.Name()) && !a.loading:
+			c.remove(path, entry, &r.Temp)
+		}
+	}
+
+	cache := filepath.Join(path, CacheDir)
+	entries, err = os.ReadDir(cache)
+	if err != nil && !os.IsNotExist(err) {
+		return r, err
+	}
+	for _, entry := range entries {
+		id, _ := audioID(entry.Name())
+		if a, ok := audios[id]; ok && a.loading {
+			continue
+		}
+		c.remove(cache, entry, &r.Temp)
+	}
+
+	if !storage.Local(store, path) {
+		err = c.collectStore(ctx, store, audios)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	for id, a := range audios {
+		if !a.ready {
+			continue
+		}
+		info, err := store.Stat(ctx, fmt.Sprintf("%s.%s", id, a.ext))
+		switch {
+		case errors.Is(err, storage.ErrNotExist):
+			r.Missing = append(r.Missing, id)
+			if opts.DryRun {
+				continue
+			}
+			err = database.SetAudioStatus(ctx, id, meta.StatusError)
+			if err == nil {
+				err = database.SetAudioSize(ctx, id, 0)
+			}
+		case err == nil && info.Size != a.size:
+			r.Sized++
+			if opts.DryRun {
+				continue
+			}
+			err = database.SetAudioSize(ctx, id, info.Size)
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+type collector struct {
+	report *Report
+	opts   Options
+	now    time.Time
+}
+
+// remove deletes entry of dir and adds it to list unless it is too young
+func (c collector) remove(dir string, entry fs.DirEntry, list *[]string) {
+	info, err := entry.Info()
+	if err != nil || c.now.Sub(info.ModTime()) < c.opts.MinAge {
+		return
+	}
+	name := filepath.Join(dir, entry.Name())
+	if !c.opts.DryRun {
+		err = os.RemoveAll(name)
+		if err != nil {
+			log.Printf("gc: %v", err)
+			return
+		}
+	}
+	*list = append(*list, name)
+	if !entry.IsDir() {
+		c.report.Freed += info.Size()
+	}
+}
+
+// collectStore removes the published files which belong to no video
+func (c collector) collectStore(ctx context.Context, store storage.Storage, audios map[uuid.UUID]*audio) error {
+	files, err := store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		id, ok := audioID(file.Name)
+		if _, known := audios[id]; !ok || known || c.now.Sub(file.ModTime) < c.opts.MinAge {
+			continue
+		}
+		if !c.opts.DryRun {
+			err = store.Delete(ctx, file.Name)
+			if err != nil {
+				return err
+			}
+		}
+		c.report.Orphans = append(c.report.Orphans, file.Name)
+		c.report.Freed += file.Size
+	}
+	return nil
+}
+
+// audioID returns the audio file a file in the audio path belongs to,
+// they are named after it
+func audioID(name string) (uuid.UUID, bool) {
+	prefix, _, ok := strings.Cut(name, ".")
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(prefix)
+	return id, err == nil
+}
+
+// isTemp reports if name is a temporary file of a download or processing
+// step, they are renamed when done
+func isTemp(name string) bool {
+	return strings.HasSuffix(name, ".part") || strings.Contains(name, ".tmp")
+}
@@ -0,0 +1,110 @@
+package gc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"tubefeed/internal/db"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+	"tubefeed/internal/storage"
+
+	"github.com/google/uuid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	database, closedb, err := db.NewDatabase(filepath.Join(dir, "tubefeed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closedb()
+	add := func(status meta.Status) uuid.UUID {
+		id := uuid.New()
+		video := meta.Video{ID: id, AudioID: id, Ext: "mp3", Meta: provider.VideoMeta{Title: "Episode"}}
+		if err := database.SaveVideoMetadata(ctx, video, 1, status); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(name string, age time.Time) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, age, age); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	ready := add(meta.StatusReady)
+	missing := add(meta.StatusReady)
+	loading := add(meta.StatusLoading)
+	kept := []string{
+		write(ready.String()+".mp3", old),
+		write(ready.String()+".jpg", old),
+		write(loading.String()+".mp3.part", old),
+		write(filepath.Join(CacheDir, loading.String()+".webm.part"), old),
+		write(uuid.NewString()+".mp3", time.Now()), // too young
+		write("notes.txt", old),
+	}
+	orphan := write(uuid.NewString()+".mp3", old)
+	temp := []string{
+		write(ready.String()+".tmp.mp3", old),
+		write(filepath.Join(CacheDir, uuid.NewString()+".webm.part"), old),
+	}
+
+	opts := Options{DryRun: true, MinAge: time.Hour}
+	_, err = Collect(ctx, database, dir, storage.NewFS(dir), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Errorf("dry run removed %s", orphan)
+	}
+	opts.DryRun = false
+	r, err := Collect(ctx, database, dir, storage.NewFS(dir), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(r.Orphans, []string{orphan}) {
+		t.Errorf("orphans %v, want %v", r.Orphans, orphan)
+	}
+	slices.Sort(r.Temp)
+	slices.Sort(temp)
+	if !slices.Equal(r.Temp, temp) {
+		t.Errorf("temporary files %v, want %v", r.Temp, temp)
+	}
+	for _, path := range append(temp, orphan) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", path)
+		}
+	}
+	for _, path := range kept {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s removed", path)
+		}
+	}
+	if !slices.Equal(r.Missing, []uuid.UUID{missing}) {
+		t.Errorf("missing %v, want %v", r.Missing, missing)
+	}
+	video, err := database.GetVideo(ctx, missing)
+	if err != nil || video.Status != meta.StatusError {
+		t.Errorf("video without file has status %s, %v", video.Status, err)
+	}
+	video, err = database.GetVideo(ctx, ready)
+	if err != nil || video.Size != 5 || r.Sized != 1 {
+		t.Errorf("size %d recorded for %d files, %v", video.Size, r.Sized, err)
+	}
+}
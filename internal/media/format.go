@@ -0,0 +1,19 @@
+package media
+
+// contentTypes of the audio files tubefeed stores
+var contentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"m4a":  "audio/mp4",
+	"aac":  "audio/aac",
+	"opus": "audio/ogg",
+	"ogg":  "audio/ogg",
+	"webm": "audio/webm",
+}
+
+// ContentType returns the mime type of audio files with extension ext
+func ContentType(ext string) string {
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
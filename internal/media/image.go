@@ -0,0 +1,79 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+var ErrMedia = errors.New("media error")
+
+// ArtworkSize is the edge length of episode artwork, podcast directories
+// ask for square images between 1400 and 3000 pixels
+const ArtworkSize = 1400
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Thumbnail downloads the image at url and stores it as square JPEG at dst.
+// The image is cropped to its center square and scaled to ArtworkSize.
+func Thumbnail(url, dst string) error {
+	src := dst + ".download"
+	defer os.Remove(src)
+	err := fetch(url, src)
+	if err != nil {
+		return err
+	}
+
+	tmp := dst + ".tmp.jpg"
+	defer os.Remove(tmp)
+	cmd := exec.Command(
+		"ffmpeg",
+		"-y",
+		"-loglevel", "error",
+		"-i", src,
+		"-vf", fmt.Sprintf("crop='min(iw,ih)':'min(iw,ih)',scale=%d:%d", ArtworkSize, ArtworkSize),
+		"-frames:v", "1",
+		"-q:v", "3",
+		tmp,
+	)
+	log.Printf("⏳ media: running cmd:  %s\n", cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: failed cmd %s: %v: %s", ErrMedia, cmd, err, out)
+	}
+	err = os.Rename(tmp, dst)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	return nil
+}
+
+// fetch stores the body of url in file dst
+func fetch(url, dst string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: fetching %s: %s", ErrMedia, url, resp.Status)
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	_, err = io.Copy(f, resp.Body)
+	err2 := f.Close()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	if err2 != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err2)
+	}
+	return nil
+}
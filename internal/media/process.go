@@ -0,0 +1,379 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"tubefeed/internal/provider"
+)
+
+// Pipeline selects the post-processing steps run after a download. The
+// zero value does nothing.
+type Pipeline struct {
+	Loudnorm    bool    // EBU R128 loudness normalisation, two pass
+	TrimSilence bool    // remove silence at the start and the end
+	Speed       float64 // tempo factor between 0.5 and 2, 0 and 1 keep the tempo
+}
+
+// Empty reports whether the pipeline has no steps
+func (p Pipeline) Empty() bool {
+	return !p.Loudnorm && !p.TrimSilence && !p.speedup()
+}
+
+func (p Pipeline) speedup() bool {
+	return p.Speed != 0 && p.Speed != 1
+}
+
+// Steps of the pipeline as recorded in Outcome
+const (
+	StepTrimSilence = "trim silence"
+	StepSpeed       = "speed"
+	StepLoudnorm    = "loudnorm"
+)
+
+// Outcome statuses
+const (
+	OutcomeApplied = "applied"
+	OutcomeSkipped = "skipped"
+	OutcomeFailed  = "failed"
+)
+
+// Outcome records what a step of the pipeline did to a file
+type Outcome struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Tempo is the speed factor applied by StepSpeed
+	Tempo float64 `json:"tempo,omitempty"`
+	// Trimmed is the silence StepTrimSilence removed from the start
+	Trimmed time.Duration `json:"trimmed,omitempty"`
+}
+
+// Loudness targets of the normalisation, common for spoken podcasts
+const (
+	targetI   = -16.0 // integrated loudness in LUFS
+	targetTP  = -1.5  // true peak in dBTP
+	targetLRA = 11.0  // loudness range in LU
+)
+
+// silenceDetect finds silence trimmed from the start and the end
+const silenceDetect = "silencedetect=noise=-50dB:d=0.5"
+
+// Process runs pipeline p on the audio file audio and replaces it once all
+// steps are encoded. A failed loudness measurement only skips that step,
+// a failed encode leaves the file untouched and fails all steps.
+// bitrate and samplerate are those of the audio profile, 0 for defaults.
+func Process(audio string, p Pipeline, bitrate, samplerate int) []Outcome {
+	var outcomes []Outcome
+	var filters []string
+	if p.TrimSilence {
+		// the silence is measured and trimmed by its length, so times in
+		// the video can be mapped to the audio
+		lead, tail, err := silence(audio)
+		if err != nil {
+			log.Printf("media: silence: %v", err)
+		}
+		if f := trimFilter(lead, tail); f != "" {
+			filters = append(filters, f)
+		}
+		outcomes = append(outcomes, Outcome{Step: StepTrimSilence, Status: OutcomeApplied, Detail: fmt.Sprintf("%.3fs at the start", lead.Seconds()), Trimmed: lead})
+	}
+	if p.speedup() {
+		if p.Speed < 0.5 || p.Speed > 2 {
+			outcomes = append(outcomes, Outcome{Step: StepSpeed, Status: OutcomeSkipped, Detail: fmt.Sprintf("factor %g out of range", p.Speed)})
+		} else {
+			filters = append(filters, fmt.Sprintf("atempo=%g", p.Speed))
+			outcomes = append(outcomes, Outcome{Step: StepSpeed, Status: OutcomeApplied, Detail: fmt.Sprintf("x%g", p.Speed), Tempo: p.Speed})
+		}
+	}
+	if p.Loudnorm {
+		m, err := measureLoudness(audio, filters)
+		if err != nil {
+			log.Printf("media: loudnorm: %v", err)
+			outcomes = append(outcomes, Outcome{Step: StepLoudnorm, Status: OutcomeFailed, Detail: err.Error()})
+		} else {
+			filters = append(filters, m.filter())
+			outcomes = append(outcomes, Outcome{Step: StepLoudnorm, Status: OutcomeApplied, Detail: fmt.Sprintf("%s LUFS to %g LUFS", m.InputI, targetI)})
+		}
+	}
+	if len(filters) == 0 {
+		return outcomes
+	}
+
+	err := encode(audio, strings.Join(filters, ","), bitrate, samplerate)
+	if err != nil {
+		log.Printf("media: %v", err)
+		for i := range outcomes {
+			if outcomes[i].Status == OutcomeApplied {
+				outcomes[i] = Outcome{Step: outcomes[i].Step, Status: OutcomeFailed, Detail: err.Error()}
+			}
+		}
+	}
+	return outcomes
+}
+
+// Cut removes segments from audio and replaces the file. segments must
+// be sorted and must not overlap.
+func Cut(audio string, segments []provider.Segment, bitrate, samplerate int) error {
+	if len(segments) == 0 {
+		return nil
+	}
+	return encode(audio, cutFilter(segments), bitrate, samplerate)
+}
+
+// cutFilter returns a filter chain dropping segments and closing the gaps
+func cutFilter(segments []provider.Segment) string {
+	var between []string
+	for _, s := range segments {
+		between = append(between, fmt.Sprintf("between(t,%.3f,%.3f)", s.Start.Seconds(), s.End.Seconds()))
+	}
+	return fmt.Sprintf("aselect='not(%s)',asetpts=N/SR/TB", strings.Join(between, "+"))
+}
+
+// Extract copies the part of audio between start and end into dst
+// without re-encoding
+func Extract(audio, dst string, start, end time.Duration) error {
+	ext := filepath.Ext(dst)
+	tmp := strings.TrimSuffix(dst, ext) + ".tmp" + ext
+	defer os.Remove(tmp)
+	cmd := exec.Command(
+		"ffmpeg",
+		"-y",
+		"-loglevel", "error",
+		"-ss", fmt.Sprintf("%.3f", start.Seconds()),
+		"-to", fmt.Sprintf("%.3f", end.Seconds()),
+		"-i", audio,
+		"-map", "0:a",
+		"-c", "copy",
+		tmp,
+	)
+	log.Printf("⏳ media: running cmd:  %s\n", cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: failed cmd %s: %v: %s", ErrMedia, cmd, err, out)
+	}
+	err = os.Rename(tmp, dst)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	return nil
+}
+
+// Tempo returns the speed factor the outcomes applied to the audio
+func Tempo(outcomes []Outcome) float64 {
+	for _, o := range outcomes {
+		if o.Step == StepSpeed && o.Status == OutcomeApplied && o.Tempo > 0 {
+			return o.Tempo
+		}
+	}
+	return 1
+}
+
+// Trimmed returns the length of the silence the outcomes removed from the
+// start of the audio
+func Trimmed(outcomes []Outcome) time.Duration {
+	for _, o := range outcomes {
+		if o.Step == StepTrimSilence && o.Status == OutcomeApplied {
+			return o.Trimmed
+		}
+	}
+	return 0
+}
+
+// silence measures the silence at the start of audio and where the
+// silence at its end starts, tail is 0 without silence at the end
+func silence(audio string) (lead, tail time.Duration, err error) {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-nostats", "-i", audio, "-af", silenceDetect, "-f", "null", "-")
+	log.Printf("⏳ media: running cmd:  %s\n", cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: failed cmd %s: %v: %s", ErrMedia, cmd, err, out)
+	}
+	lead, tail = parseSilence(out)
+	return lead, tail, nil
+}
+
+// parseSilence returns the end of the first silence silencedetect printed
+// if it starts the audio, and the start of the last one if it lasts until
+// the end. A silence at the end has no silence_end or ends at the duration
+// of the input. Audio silent throughout is not trimmed.
+func parseSilence(out []byte) (lead, tail time.Duration) {
+	type span struct {
+		start, end float64
+		open       bool
+	}
+	var spans []span
+	duration := -1.0
+	for _, line := range strings.Split(string(out), "\n") {
+		if i := strings.Index(line, "Duration: "); i >= 0 && duration < 0 {
+			field, _, _ := strings.Cut(line[i+len("Duration: "):], ",")
+			duration = parseClock(field)
+		}
+		if i := strings.Index(line, "silence_start: "); i >= 0 {
+			start, _ := strconv.ParseFloat(strings.TrimSpace(line[i+len("silence_start: "):]), 64)
+			spans = append(spans, span{start: start, open: true})
+		}
+		if i := strings.Index(line, "silence_end: "); i >= 0 && len(spans) > 0 {
+			field, _, _ := strings.Cut(line[i+len("silence_end: "):], " ")
+			last := &spans[len(spans)-1]
+			last.end, _ = strconv.ParseFloat(field, 64)
+			last.open = false
+		}
+	}
+	if len(spans) == 0 {
+		return 0, 0
+	}
+	atEnd := func(s span) bool {
+		return s.open || (duration > 0 && s.end >= duration-0.05)
+	}
+	// the first silence may start a few samples in
+	first, last := spans[0], spans[len(spans)-1]
+	if first.start <= 0.01 {
+		if atEnd(first) {
+			return 0, 0
+		}
+		lead = seconds(first.end)
+	}
+	if atEnd(last) {
+		tail = seconds(last.start)
+	}
+	return lead, tail
+}
+
+// parseClock parses a duration printed as hh:mm:ss.ss, -1 if it is not one
+func parseClock(s string) float64 {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return -1
+	}
+	var secs float64
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return -1
+		}
+		secs = secs*60 + v
+	}
+	return secs
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// trimFilter cuts the audio before lead and after tail, tail 0 keeps the end
+func trimFilter(lead, tail time.Duration) string {
+	var bounds []string
+	if lead > 0 {
+		bounds = append(bounds, fmt.Sprintf("start=%.3f", lead.Seconds()))
+	}
+	if tail > lead {
+		bounds = append(bounds, fmt.Sprintf("end=%.3f", tail.Seconds()))
+	}
+	if len(bounds) == 0 {
+		return ""
+	}
+	return "atrim=" + strings.Join(bounds, ":") + ",asetpts=PTS-STARTPTS"
+}
+
+// loudness is the first pass measurement printed by the loudnorm filter
+type loudness struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// filter returns the second pass loudnorm filter using the measurement
+func (m loudness) filter() string {
+	return fmt.Sprintf(
+		"loudnorm=I=%g:TP=%g:LRA=%g:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		targetI, targetTP, targetLRA, m.InputI, m.InputTP, m.InputLRA, m.InputThresh, m.TargetOffset,
+	)
+}
+
+// measureLoudness runs the first loudnorm pass after filters
+func measureLoudness(audio string, filters []string) (loudness, error) {
+	af := append(filters[:len(filters):len(filters)],
+		fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:print_format=json", targetI, targetTP, targetLRA))
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-nostats", "-i", audio, "-af", strings.Join(af, ","), "-f", "null", "-")
+	log.Printf("⏳ media: running cmd:  %s\n", cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return loudness{}, fmt.Errorf("%w: failed cmd %s: %v: %s", ErrMedia, cmd, err, out)
+	}
+	return parseLoudness(out)
+}
+
+// parseLoudness extracts the json block loudnorm prints at the end of the
+// ffmpeg output
+func parseLoudness(out []byte) (loudness, error) {
+	s := string(out)
+	start := strings.LastIndex(s, "{")
+	end := strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return loudness{}, fmt.Errorf("%w: no loudnorm measurement in output", ErrMedia)
+	}
+	var m loudness
+	err := json.Unmarshal([]byte(s[start:end+1]), &m)
+	if err != nil {
+		return loudness{}, fmt.Errorf("%w: loudnorm measurement: %v", ErrMedia, err)
+	}
+	if i, err := strconv.ParseFloat(m.InputI, 64); err != nil || math.IsInf(i, 0) {
+		// silent input measures -inf, there is nothing to normalise
+		return loudness{}, fmt.Errorf("%w: loudnorm measured %q", ErrMedia, m.InputI)
+	}
+	return m, nil
+}
+
+// encode re-encodes audio with the filter chain af in its own format and
+// replaces the file atomically
+func encode(audio, af string, bitrate, samplerate int) error {
+	ext := filepath.Ext(audio)
+	tmp := strings.TrimSuffix(audio, ext) + ".tmp" + ext
+	defer os.Remove(tmp)
+
+	args := []string{"-y", "-loglevel", "error", "-i", audio, "-map", "0:a", "-af", af}
+	args = append(args, codecArgs(ext, bitrate, samplerate)...)
+	cmd := exec.Command("ffmpeg", append(args, tmp)...)
+	log.Printf("⏳ media: running cmd:  %s\n", cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: failed cmd %s: %v: %s", ErrMedia, cmd, err, out)
+	}
+	err = os.Rename(tmp, audio)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	return nil
+}
+
+// codecArgs returns the encoder arguments for files with extension ext.
+// loudnorm upsamples to 192kHz, so the sample rate is always set.
+func codecArgs(ext string, bitrate, samplerate int) []string {
+	codec, rate := "libmp3lame", 44100
+	switch ext {
+	case ".m4a", ".aac":
+		codec = "aac"
+	case ".opus", ".webm":
+		codec, rate = "libopus", 48000
+	case ".ogg":
+		codec = "libvorbis"
+	}
+	if samplerate > 0 {
+		rate = samplerate
+	}
+	args := []string{"-c:a", codec, "-ar", strconv.Itoa(rate)}
+	if bitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", bitrate))
+	}
+	return args
+}
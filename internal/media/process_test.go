@@ -0,0 +1,137 @@
+package media
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"tubefeed/internal/provider"
+)
+
+func TestParseLoudness(t *testing.T) {
+	out := []byte(`[Parsed_loudnorm_0 @ 0x55d5c] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`)
+	m, err := parseLoudness(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.20:offset=0.58:linear=true"
+	if got := m.filter(); got != want {
+		t.Errorf("filter() = %q, want %q", got, want)
+	}
+}
+
+func TestParseLoudnessSilent(t *testing.T) {
+	_, err := parseLoudness([]byte(`{"input_i" : "-inf", "input_tp" : "-inf"}`))
+	if err == nil {
+		t.Error("expected error for silent input")
+	}
+	_, err = parseLoudness([]byte("no json"))
+	if err == nil {
+		t.Error("expected error without measurement")
+	}
+}
+
+func TestCodecArgs(t *testing.T) {
+	cases := map[string]string{
+		".mp3":  "-c:a libmp3lame -ar 44100",
+		".opus": "-c:a libopus -ar 48000",
+		".m4a":  "-c:a aac -ar 44100",
+	}
+	for ext, want := range cases {
+		if got := strings.Join(codecArgs(ext, 0, 0), " "); got != want {
+			t.Errorf("codecArgs(%q) = %q, want %q", ext, got, want)
+		}
+	}
+	if got := strings.Join(codecArgs(".mp3", 96, 22050), " "); got != "-c:a libmp3lame -ar 22050 -b:a 96k" {
+		t.Errorf("codecArgs with profile = %q", got)
+	}
+}
+
+func TestTempo(t *testing.T) {
+	outcomes := []Outcome{
+		{Step: StepTrimSilence, Status: OutcomeApplied},
+		{Step: StepSpeed, Status: OutcomeApplied, Detail: "x1.25", Tempo: 1.25},
+	}
+	if got := Tempo(outcomes); got != 1.25 {
+		t.Errorf("Tempo() = %g", got)
+	}
+	outcomes[1].Status = OutcomeFailed
+	if got := Tempo(outcomes); got != 1 {
+		t.Errorf("Tempo() of failed step = %g", got)
+	}
+}
+
+func TestTrimmed(t *testing.T) {
+	outcomes := []Outcome{{Step: StepTrimSilence, Status: OutcomeApplied, Detail: "2.345s at the start", Trimmed: 2345 * time.Millisecond}}
+	if got := Trimmed(outcomes); got != 2345*time.Millisecond {
+		t.Errorf("Trimmed() = %v", got)
+	}
+	outcomes[0].Status = OutcomeFailed
+	if got := Trimmed(outcomes); got != 0 {
+		t.Errorf("Trimmed() of failed step = %v", got)
+	}
+}
+
+func TestParseSilence(t *testing.T) {
+	const header = "Input #0, mp3, from 'a.mp3':\n  Duration: 00:01:00.00, start: 0.025057, bitrate: 128 kb/s\n"
+	cases := []struct {
+		name       string
+		out        string
+		lead, tail time.Duration
+	}{
+		{"start", header + "[silencedetect @ 0x1] silence_start: 0\n[silencedetect @ 0x1] silence_end: 2.345 | silence_duration: 2.345\n", 2345 * time.Millisecond, 0},
+		{"early start", header + "[silencedetect @ 0x1] silence_start: -0.002\n[silencedetect @ 0x1] silence_end: 1.5 | silence_duration: 1.502\n", 1500 * time.Millisecond, 0},
+		{"middle", header + "[silencedetect @ 0x1] silence_start: 12.5\n[silencedetect @ 0x1] silence_end: 14 | silence_duration: 1.5\n", 0, 0},
+		{"open end", header + "[silencedetect @ 0x1] silence_start: 57.5\n", 0, 57500 * time.Millisecond},
+		{"closed end", header + "[silencedetect @ 0x1] silence_start: 58\n[silencedetect @ 0x1] silence_end: 60 | silence_duration: 2\n", 0, 58 * time.Second},
+		{"both", header + "[silencedetect @ 0x1] silence_start: 0\n[silencedetect @ 0x1] silence_end: 1 | silence_duration: 1\n[silencedetect @ 0x1] silence_start: 30\n[silencedetect @ 0x1] silence_end: 31 | silence_duration: 1\n[silencedetect @ 0x1] silence_start: 59\n", time.Second, 59 * time.Second},
+		{"silent", header + "[silencedetect @ 0x1] silence_start: 0\n", 0, 0},
+		{"none", "no silence", 0, 0},
+	}
+	for _, tc := range cases {
+		lead, tail := parseSilence([]byte(tc.out))
+		if lead != tc.lead || tail != tc.tail {
+			t.Errorf("%s: parseSilence() = %v, %v, want %v, %v", tc.name, lead, tail, tc.lead, tc.tail)
+		}
+	}
+}
+
+func TestTrimFilter(t *testing.T) {
+	cases := []struct {
+		lead, tail time.Duration
+		want       string
+	}{
+		{0, 0, ""},
+		{1500 * time.Millisecond, 0, "atrim=start=1.500,asetpts=PTS-STARTPTS"},
+		{0, 58 * time.Second, "atrim=end=58.000,asetpts=PTS-STARTPTS"},
+		{time.Second, 59 * time.Second, "atrim=start=1.000:end=59.000,asetpts=PTS-STARTPTS"},
+	}
+	for _, tc := range cases {
+		if got := trimFilter(tc.lead, tc.tail); got != tc.want {
+			t.Errorf("trimFilter(%v, %v) = %q, want %q", tc.lead, tc.tail, got, tc.want)
+		}
+	}
+}
+
+func TestCutFilter(t *testing.T) {
+	segments := []provider.Segment{
+		{Start: 0, End: 10 * time.Second},
+		{Start: 120500 * time.Millisecond, End: 200 * time.Second},
+	}
+	want := "aselect='not(between(t,0.000,10.000)+between(t,120.500,200.000))',asetpts=N/SR/TB"
+	if got := cutFilter(segments); got != want {
+		t.Errorf("cutFilter() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+)
+
+// streamMuxers are the ffmpeg muxers of the formats which can be written
+// to a pipe, mp4 needs to seek back to write its index
+var streamMuxers = map[string]string{
+	"mp3":  "mp3",
+	"opus": "opus",
+}
+
+// Streamable reports whether audio files with extension ext can be
+// encoded while the source is still downloading
+func Streamable(ext string) bool {
+	_, ok := streamMuxers[ext]
+	return ok
+}
+
+// Transcode encodes the audio read from src to the format of extension ext
+// and writes it to dst as it is produced
+func Transcode(ctx context.Context, src io.Reader, dst io.Writer, ext string, bitrate, channels, samplerate int) error {
+	muxer, ok := streamMuxers[ext]
+	if !ok {
+		return fmt.Errorf("%w: %s can't be streamed", ErrMedia, ext)
+	}
+	args := []string{"-loglevel", "error", "-i", "pipe:0", "-map", "0:a"}
+	args = append(args, codecArgs("."+ext, bitrate, samplerate)...)
+	if channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(channels))
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", append(args, "-f", muxer, "pipe:1")...)
+	var stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = src, dst, &stderr
+	log.Printf("⏳ media: running cmd:  %s\n", cmd)
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%w: failed cmd %s: %v: %s", ErrMedia, cmd, err, stderr.Bytes())
+	}
+	return nil
+}
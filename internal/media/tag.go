@@ -0,0 +1,107 @@
+package media
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"tubefeed/internal/provider"
+)
+
+// Tags are the ID3 tags written into an mp3 file
+type Tags struct {
+	Title    string
+	Artist   string
+	Album    string
+	Date     time.Time
+	Comment  string
+	Chapters []provider.Chapter
+	Cover    string // path of a JPEG embedded as front cover, optional
+}
+
+// Tag rewrites the tags of the audio file audio: ID3v2 for mp3, the
+// native tags of the container otherwise. The audio stream is copied, the
+// file is replaced once ffmpeg succeeded. Cover art is only embedded in
+// mp3 and m4a files, ffmpeg can't write it into ogg or webm.
+func Tag(audio string, tags Tags) error {
+	metafile := audio + ".ffmeta"
+	err := os.WriteFile(metafile, []byte(ffmetadata(tags)), 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	defer os.Remove(metafile)
+
+	ext := filepath.Ext(audio)
+	cover := tags.Cover != "" && (ext == ".mp3" || ext == ".m4a")
+	args := []string{"-y", "-loglevel", "error", "-i", audio, "-i", metafile}
+	if cover {
+		args = append(args, "-i", tags.Cover)
+	}
+	args = append(args, "-map", "0:a", "-map_metadata", "1", "-map_chapters", "1")
+	if cover {
+		args = append(args,
+			"-map", "2:v",
+			"-disposition:v", "attached_pic",
+			"-metadata:s:v", "title=Album cover",
+			"-metadata:s:v", "comment=Cover (front)",
+		)
+	}
+	args = append(args, "-c", "copy")
+	if ext == ".mp3" {
+		args = append(args, "-id3v2_version", "3", "-write_id3v1", "1")
+	}
+	tmp := strings.TrimSuffix(audio, ext) + ".tmp" + ext
+	defer os.Remove(tmp)
+	args = append(args, tmp)
+
+	cmd := exec.Command("ffmpeg", args...)
+	log.Printf("⏳ media: running cmd:  %s\n", cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: failed cmd %s: %v: %s", ErrMedia, cmd, err, out)
+	}
+	err = os.Rename(tmp, audio)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMedia, err)
+	}
+	return nil
+}
+
+// ffmetadata renders tags in the ffmpeg metadata file format. ffmpeg
+// writes the chapters as ID3 CHAP frames with a CTOC listing them.
+func ffmetadata(tags Tags) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	field := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s=%s\n", key, escapeMeta(value))
+		}
+	}
+	field("title", tags.Title)
+	field("artist", tags.Artist)
+	field("album", tags.Album)
+	if !tags.Date.IsZero() {
+		field("date", tags.Date.Format("2006-01-02"))
+	}
+	field("comment", tags.Comment)
+	for _, ch := range tags.Chapters {
+		b.WriteString("[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&b, "START=%d\nEND=%d\n", ch.Start.Milliseconds(), ch.End.Milliseconds())
+		field("title", ch.Title)
+	}
+	return b.String()
+}
+
+// escapeMeta escapes the characters special to ffmetadata files
+func escapeMeta(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		"=", `\=`,
+		";", `\;`,
+		"#", `\#`,
+		"\n", "\\\n",
+	).Replace(s)
+}
@@ -0,0 +1,47 @@
+package media
+
+import (
+	"testing"
+	"time"
+	"tubefeed/internal/provider"
+)
+
+func TestFfmetadata(t *testing.T) {
+	tags := Tags{
+		Title:   "Part 1; a=b #1",
+		Artist:  "Channel",
+		Album:   "Tab",
+		Date:    time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		Comment: "https://www.youtube.com/watch?v=abc123",
+		Chapters: []provider.Chapter{
+			{Start: 0, End: 60500 * time.Millisecond, Title: "Intro"},
+			{Start: 60500 * time.Millisecond, End: 2 * time.Minute, Title: "Main"},
+		},
+	}
+	want := `;FFMETADATA1
+title=Part 1\; a\=b \#1
+artist=Channel
+album=Tab
+date=2024-01-31
+comment=https://www.youtube.com/watch?v\=abc123
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=60500
+title=Intro
+[CHAPTER]
+TIMEBASE=1/1000
+START=60500
+END=120000
+title=Main
+`
+	if got := ffmetadata(tags); got != want {
+		t.Errorf("ffmetadata() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFfmetadataEmpty(t *testing.T) {
+	if got := ffmetadata(Tags{}); got != ";FFMETADATA1\n" {
+		t.Errorf("ffmetadata() = %q", got)
+	}
+}
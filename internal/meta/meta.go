@@ -1,7 +1,15 @@
 package meta
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"tubefeed/internal/media"
 	"tubefeed/internal/provider"
 	"tubefeed/internal/provider/registry"
 	"tubefeed/internal/utils"
@@ -14,6 +22,83 @@ type Video struct {
 	Status   Status
 	Meta     provider.VideoMeta
 	ID       uuid.UUID
+	Tabid    int
+	AudioID  uuid.UUID // names the audio file, copies share the file of the original
+	Ext      string    // extension of the audio file
+	// Processing records the post-processing steps run on the audio file
+	Processing []media.Outcome
+	Tempo      float64 // speed of the audio file relative to the video
+	// Trimmed is the silence removed from the start of the audio file
+	Trimmed time.Duration
+	// Cut are the parts of the video removed from the audio file, in order
+	Cut      []provider.Segment
+	Position int // manual order within the tab
+	Added    time.Time
+	Played   bool
+	// Split requests a child episode per chapter once downloaded
+	Split    bool
+	ParentID uuid.UUID // video this chapter episode was split from, or uuid.Nil
+	// TranscriptLang is the language of the transcript files, empty if the
+	// video has none
+	TranscriptLang string
+	Size           int64 // bytes of the audio file, 0 if unknown or not downloaded
+}
+
+// Tab holds the settings of a tab
+type Tab struct {
+	ID      int
+	Name    string
+	Sort    SortMode
+	Serial  bool // published as serial podcast with numbered episodes
+	Lazy    bool // audio is only downloaded when a podcast app requests it
+	Audio   provider.AudioOptions
+	Process media.Pipeline
+	// Retention expires old episodes
+	Retention Retention
+	Quota     int64 // bytes of audio before new episodes are rejected, 0 unlimited
+}
+
+type SortMode string
+
+var (
+	SortManual   SortMode = "manual"
+	SortAdded    SortMode = "added"
+	SortUploaded SortMode = "uploaded"
+	SortTitle    SortMode = "title"
+	SortChannel  SortMode = "channel"
+)
+
+// ParseSortMode returns the SortMode named s
+func ParseSortMode(s string) (SortMode, error) {
+	mode := SortMode(s)
+	switch mode {
+	case SortManual, SortAdded, SortUploaded, SortTitle, SortChannel:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown sort mode: %q", s)
+}
+
+// SortVideos orders videos by mode. Videos are expected in manual order,
+// sorting is stable so manual order breaks ties.
+func SortVideos(videos []Video, mode SortMode) {
+	switch mode {
+	case SortAdded:
+		slices.SortStableFunc(videos, func(a, b Video) int {
+			return b.Added.Compare(a.Added)
+		})
+	case SortUploaded:
+		slices.SortStableFunc(videos, func(a, b Video) int {
+			return b.Meta.UploadDate.Compare(a.Meta.UploadDate)
+		})
+	case SortTitle:
+		slices.SortStableFunc(videos, func(a, b Video) int {
+			return strings.Compare(strings.ToLower(a.Meta.Title), strings.ToLower(b.Meta.Title))
+		})
+	case SortChannel:
+		slices.SortStableFunc(videos, func(a, b Video) int {
+			return strings.Compare(strings.ToLower(a.Meta.Channel), strings.ToLower(b.Meta.Channel))
+		})
+	}
 }
 
 type VideoProviderList map[string]provider.ProviderNewVideoFn
@@ -24,47 +109,165 @@ type Provider struct {
 
 type Status string
 
+var ErrUnsupported = errors.New("unsupported video url")
+
 var (
 	StatusNew     Status = "New"
 	StatusMeta    Status = "FetchingMeta"
 	StatusLoading Status = "Downloading"
 	StatusReady   Status = "Available"
 	StatusError   Status = "Error"
+	// StatusOnDemand is listed in the feed, the audio is downloaded when
+	// it is first requested
+	StatusOnDemand Status = "OnDemand"
 )
 
-func (vm *Video) Download(path string) error {
-	if vm.provider == nil {
-		domain, err := utils.ExtractDomain(vm.Meta.URL)
-		if err != nil {
-			return err
-		}
-		new := registry.Get(domain)
-		if new == nil {
-			return fmt.Errorf("failed to Download")
-		}
-		provider, err := new(vm.Meta.URL)
-		if err != nil {
-			return err
+// AudioTime converts a position in the video to the position in the audio
+// file, which may have been cut, trimmed and sped up
+func (vm Video) AudioTime(d time.Duration) time.Duration {
+	pos := d
+	for _, s := range vm.Cut {
+		if d <= s.Start {
+			break
 		}
-		vm.provider = provider
+		pos -= min(d, s.End) - s.Start
+	}
+	pos = max(pos-vm.Trimmed, 0)
+	if vm.Tempo <= 0 {
+		return pos
+	}
+	return time.Duration(float64(pos) / vm.Tempo)
+}
+
+// IsChapter reports whether the video was split from a parent video
+func (vm Video) IsChapter() bool {
+	return vm.ParentID != uuid.Nil
+}
+
+// ChapterEpisode returns the child episode of chapter i. It gets its own
+// ID and audio file, which is cut from the audio of vm.
+func (vm Video) ChapterEpisode(i int) Video {
+	ch := vm.Meta.Chapters[i]
+	md := vm.Meta
+	md.Title = fmt.Sprintf("%s: %s", vm.Meta.Title, ch.Title)
+	md.Length = vm.AudioTime(ch.End) - vm.AudioTime(ch.Start)
+	md.URL = timeURL(vm.Meta.URL, ch.Start)
+	md.Chapters = nil
+	id := uuid.New()
+	return Video{
+		Status:   StatusReady,
+		Meta:     md,
+		ID:       id,
+		Tabid:    vm.Tabid,
+		AudioID:  id,
+		Ext:      vm.Ext,
+		Tempo:    1,
+		Added:    vm.Added.Add(time.Duration(i+1) * time.Second), // keeps the order in feeds
+		ParentID: vm.ID,
+	}
+}
+
+// timeURL links the video at u to start at t, u is kept if it is no url
+func timeURL(u string, t time.Duration) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	query := parsed.Query()
+	query.Set("t", fmt.Sprintf("%ds", int(t.Seconds())))
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// Stream returns the original audio of the video while it downloads, ok
+// is false if the provider can't stream
+func (vm *Video) Stream(ctx context.Context) (r io.ReadCloser, ok bool, err error) {
+	err = vm.loadProvider()
+	if err != nil {
+		return nil, false, err
 	}
-	return vm.provider.Download(vm.ID, path)
+	streamer, ok := vm.provider.(provider.Streamer)
+	if !ok {
+		return nil, false, nil
+	}
+	r, err = streamer.Stream(ctx)
+	return r, true, err
+}
+
+// FinishStream moves the streamed audio file to path, see
+// provider.Streamer
+func (vm *Video) FinishStream(file, path string, opts provider.AudioOptions) (provider.AudioFile, error) {
+	err := vm.loadProvider()
+	if err != nil {
+		return provider.AudioFile{}, err
+	}
+	streamer, ok := vm.provider.(provider.Streamer)
+	if !ok {
+		return provider.AudioFile{}, fmt.Errorf("%w: %s can't stream", ErrUnsupported, vm.Meta.URL)
+	}
+	return streamer.Finish(vm.AudioID, file, path, opts)
+}
+
+// Download stores the audio of the video in path and sets Ext and Cut
+func (vm *Video) Download(path string, opts provider.AudioOptions) (provider.AudioFile, error) {
+	err := vm.loadProvider()
+	if err != nil {
+		return provider.AudioFile{}, err
+	}
+	file, err := vm.provider.Download(vm.AudioID, path, opts)
+	if err != nil {
+		return provider.AudioFile{}, err
+	}
+	vm.Ext = file.Ext
+	vm.Cut = file.Cut
+	return file, nil
+}
+
+// loadProvider sets the provider of videos loaded from the database
+func (vm *Video) loadProvider() error {
+	if vm.provider != nil {
+		return nil
+	}
+	domain, err := utils.ExtractDomain(vm.Meta.URL)
+	if err != nil {
+		return err
+	}
+	new := registry.Get(domain)
+	if new == nil {
+		return fmt.Errorf("%w: no provider for %s", ErrUnsupported, domain)
+	}
+	provider, err := new(vm.Meta.URL)
+	if err != nil {
+		return err
+	}
+	vm.provider = provider
+	return nil
 }
 
 func NewVideo(url string) (Video, error) {
-	domain, _ := utils.ExtractDomain(url)
+	domain, err := utils.ExtractDomain(url)
+	if err != nil {
+		return Video{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
 	new := registry.Get(domain)
+	if new == nil {
+		return Video{}, fmt.Errorf("%w: no provider for %s", ErrUnsupported, domain)
+	}
 	prov, err := new(url)
 	if err != nil {
-		return Video{}, err
+		return Video{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
 	}
 
 	meta := provider.VideoMeta{
 		URL:   prov.Url(),
 		Title: "Loading...",
 	}
+	id := uuid.New()
 	return Video{
-		ID:       uuid.New(),
+		ID:       id,
+		AudioID:  id,
+		Ext:      string(provider.FormatMP3),
+		Tempo:    1,
 		Meta:     meta,
 		provider: prov,
 		Status:   StatusNew,
@@ -72,6 +275,10 @@ func NewVideo(url string) (Video, error) {
 }
 
 func (vm *Video) LoadMeta() error {
+	err := vm.loadProvider()
+	if err != nil {
+		return err
+	}
 
 	videomd, err := vm.provider.LoadMetadata()
 	if err != nil {
@@ -0,0 +1,78 @@
+package meta
+
+import (
+	"testing"
+	"time"
+	"tubefeed/internal/provider"
+
+	"github.com/google/uuid"
+)
+
+func TestAudioTime(t *testing.T) {
+	video := Video{
+		Tempo: 1,
+		Cut: []provider.Segment{
+			{Start: 0, End: 10 * time.Second},
+			{Start: 60 * time.Second, End: 90 * time.Second},
+		},
+	}
+	cases := map[time.Duration]time.Duration{
+		5 * time.Second:   0,
+		30 * time.Second:  20 * time.Second,
+		75 * time.Second:  50 * time.Second,
+		120 * time.Second: 80 * time.Second,
+	}
+	for in, want := range cases {
+		if got := video.AudioTime(in); got != want {
+			t.Errorf("AudioTime(%v) = %v, want %v", in, got, want)
+		}
+	}
+	video.Tempo = 2
+	if got := video.AudioTime(120 * time.Second); got != 40*time.Second {
+		t.Errorf("AudioTime at double speed = %v", got)
+	}
+	video.Trimmed = 4 * time.Second
+	if got := video.AudioTime(120 * time.Second); got != 38*time.Second {
+		t.Errorf("AudioTime after trimming silence = %v", got)
+	}
+	if got := video.AudioTime(12 * time.Second); got != 0 {
+		t.Errorf("AudioTime in trimmed silence = %v", got)
+	}
+}
+
+func TestChapterEpisode(t *testing.T) {
+	parent := Video{
+		ID:    uuid.New(),
+		Tabid: 2,
+		Ext:   "mp3",
+		Tempo: 1,
+		Added: time.Unix(1700000000, 0),
+		Cut:   []provider.Segment{{Start: 0, End: 10 * time.Second}},
+		Meta: provider.VideoMeta{
+			Title: "Conference",
+			URL:   "https://www.youtube.com/watch?v=abc123",
+			Chapters: []provider.Chapter{
+				{Start: 0, End: 60 * time.Second, Title: "Welcome"},
+				{Start: 60 * time.Second, End: 600 * time.Second, Title: "Keynote"},
+			},
+		},
+	}
+	child := parent.ChapterEpisode(1)
+	if !child.IsChapter() || child.ParentID != parent.ID || child.ID == parent.ID || child.AudioID != child.ID {
+		t.Errorf("unexpected ids: %+v", child)
+	}
+	if child.Meta.Title != "Conference: Keynote" || child.Meta.URL != "https://www.youtube.com/watch?t=60s&v=abc123" {
+		t.Errorf("unexpected meta: %+v", child.Meta)
+	}
+	if child.Meta.Length != 540*time.Second || child.Meta.Chapters != nil {
+		t.Errorf("Length = %v, Chapters = %v", child.Meta.Length, child.Meta.Chapters)
+	}
+	if !child.Added.After(parent.ChapterEpisode(0).Added) || child.Tabid != 2 || child.Status != StatusReady {
+		t.Errorf("unexpected child: %+v", child)
+	}
+
+	parent.Meta.URL = "https://youtu.be/abc123"
+	if got := parent.ChapterEpisode(1).Meta.URL; got != "https://youtu.be/abc123?t=60s" {
+		t.Errorf("URL without query = %q", got)
+	}
+}
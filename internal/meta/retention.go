@@ -0,0 +1,75 @@
+package meta
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Retention are the rules expiring old episodes of a tab, the zero value
+// keeps all of them
+type Retention struct {
+	KeepLast     int           // newest episodes kept, 0 keeps all
+	MaxAge       time.Duration // episodes added longer ago expire, 0 never
+	KeepUnplayed bool          // unplayed episodes never expire
+	MaxSize      int64         // bytes of audio kept, 0 unlimited
+}
+
+// Enabled reports whether any rule expires episodes
+func (r Retention) Enabled() bool {
+	return r.KeepLast > 0 || r.MaxAge > 0 || r.MaxSize > 0
+}
+
+// Expired returns the videos the rules remove at now, newest first. Only
+// episodes listed in the feed count towards KeepLast and MaxSize, size
+// returns the bytes of the audio of a video. The oldest episodes go first
+// when the tab is over MaxSize. Failed downloads only expire by MaxAge,
+// videos split into chapter episodes count as their chapters.
+func (r Retention) Expired(videos []Video, now time.Time, size func(Video) int64) []Video {
+	if !r.Enabled() {
+		return nil
+	}
+	split := make(map[uuid.UUID]bool)
+	for _, video := range videos {
+		if video.IsChapter() {
+			split[video.ParentID] = true
+		}
+	}
+	var done []Video
+	for _, video := range videos {
+		if split[video.ID] {
+			continue
+		}
+		switch video.Status {
+		case StatusReady, StatusOnDemand, StatusError:
+			done = append(done, video)
+		}
+	}
+	slices.SortStableFunc(done, func(a, b Video) int {
+		return b.Added.Compare(a.Added)
+	})
+
+	var expired []Video
+	var kept int
+	var total int64
+	for _, video := range done {
+		if video.Status == StatusError {
+			if r.MaxAge > 0 && now.Sub(video.Added) > r.MaxAge {
+				expired = append(expired, video)
+			}
+			continue
+		}
+		bytes := size(video)
+		expire := (r.KeepLast > 0 && kept >= r.KeepLast) ||
+			(r.MaxAge > 0 && now.Sub(video.Added) > r.MaxAge) ||
+			(r.MaxSize > 0 && total+bytes > r.MaxSize)
+		if expire && !(r.KeepUnplayed && !video.Played) {
+			expired = append(expired, video)
+			continue
+		}
+		kept++
+		total += bytes
+	}
+	return expired
+}
@@ -0,0 +1,76 @@
+package meta
+
+import (
+	"slices"
+	"testing"
+	"time"
+	"tubefeed/internal/provider"
+
+	"github.com/google/uuid"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	videos := []Video{
+		{Meta: provider.VideoMeta{Title: "a"}, Status: StatusReady, Added: now.Add(-1 * day), Played: true},
+		{Meta: provider.VideoMeta{Title: "b"}, Status: StatusReady, Added: now.Add(-5 * day)},
+		{Meta: provider.VideoMeta{Title: "c"}, Status: StatusOnDemand, Added: now.Add(-10 * day), Played: true},
+		{Meta: provider.VideoMeta{Title: "d"}, Status: StatusLoading, Added: now.Add(-20 * day)},
+		{Meta: provider.VideoMeta{Title: "e"}, Status: StatusError, Added: now.Add(-30 * day), Played: true},
+	}
+	size := func(Video) int64 { return 100 }
+	cases := []struct {
+		name string
+		r    Retention
+		want []string
+	}{
+		{"none", Retention{}, nil},
+		{"keep last", Retention{KeepLast: 2}, []string{"c"}},
+		{"max age", Retention{MaxAge: 7 * day}, []string{"c", "e"}},
+		{"max size", Retention{MaxSize: 250}, []string{"c"}},
+		{"unplayed", Retention{KeepLast: 1, KeepUnplayed: true}, []string{"c"}},
+		{"unplayed kept", Retention{MaxAge: 2 * day, KeepUnplayed: true}, []string{"c", "e"}},
+		{"all", Retention{MaxAge: time.Hour}, []string{"a", "b", "c", "e"}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, video := range c.r.Expired(videos, now, size) {
+			got = append(got, video.Meta.Title)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRetentionExpiredSplit(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	parent := Video{ID: uuid.New(), Meta: provider.VideoMeta{Title: "parent"}, Status: StatusReady, Added: now.Add(-10 * day)}
+	videos := []Video{
+		parent,
+		{ID: uuid.New(), ParentID: parent.ID, Meta: provider.VideoMeta{Title: "chapter 1"}, Status: StatusReady, Added: now.Add(-10*day + time.Second)},
+		{ID: uuid.New(), ParentID: parent.ID, Meta: provider.VideoMeta{Title: "chapter 2"}, Status: StatusReady, Added: now.Add(-10*day + 2*time.Second)},
+		{ID: uuid.New(), Meta: provider.VideoMeta{Title: "single"}, Status: StatusReady, Added: now.Add(-1 * day)},
+	}
+	size := func(Video) int64 { return 100 }
+	cases := []struct {
+		name string
+		r    Retention
+		want []string
+	}{
+		{"keep last", Retention{KeepLast: 2}, []string{"chapter 1"}},
+		{"max size", Retention{MaxSize: 300}, nil},
+		{"max age", Retention{MaxAge: 7 * day}, []string{"chapter 2", "chapter 1"}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, video := range c.r.Expired(videos, now, size) {
+			got = append(got, video.Meta.Title)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+	"tubefeed/internal/utils"
+
+	"github.com/google/uuid"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrDiskFull is returned for downloads which would fill up the disk
+var ErrDiskFull = errors.New("not enough disk space")
+
+// coordinator runs each audio download once, however many workers and
+// requests ask for it, and at most limit downloads at a time
+type coordinator struct {
+	group singleflight.Group
+	slots chan struct{}
+}
+
+func newCoordinator(limit int) *coordinator {
+	return &coordinator{slots: make(chan struct{}, max(limit, 1))}
+}
+
+// do runs fn for key unless it is running already, then it waits for the
+// running call. Returning early on ctx leaves fn running for the others.
+func (c *coordinator) do(ctx context.Context, key string, fn func() error) error {
+	ch := c.join(key, fn)
+	select {
+	case res := <-ch:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// join starts fn for key in a free slot or joins the running call, the
+// result is sent on the returned channel
+func (c *coordinator) join(key string, fn func() error) <-chan singleflight.Result {
+	return c.group.DoChan(key, func() (any, error) {
+		c.slots <- struct{}{}
+		defer func() { <-c.slots }()
+		return nil, fn()
+	})
+}
+
+// Fetch downloads the audio of video with the audio profile of tabid and
+// prepares it for the feed. Concurrent fetches of the same audio file
+// share one download, it continues if ctx ends.
+func (w *Worker) Fetch(ctx context.Context, video meta.Video, tabid int) error {
+	return w.fetches.do(ctx, video.AudioID.String(), func() error {
+		return w.fetch(context.Background(), video, tabid)
+	})
+}
+
+// fetch moves video through StatusLoading to StatusReady, or StatusError
+// if the download fails. Later steps only log their failures, the audio
+// is usable without them.
+func (w *Worker) fetch(ctx context.Context, video meta.Video, tabid int) error {
+	// a fetch which finished just before this one was started
+	if video.Ext != "" {
+		_, err := w.store.Stat(ctx, fmt.Sprintf("%s.%s", video.AudioID, video.Ext))
+		if err == nil {
+			return nil
+		}
+	}
+	err := w.checkSpace()
+	if err != nil {
+		w.setStatus(ctx, video, meta.StatusError)
+		return err
+	}
+	w.setStatus(ctx, video, meta.StatusLoading)
+	file, err := video.Download(w.path, w.audioOptions(ctx, tabid))
+	if err == nil {
+		err = w.db.SetAudioFile(ctx, video.AudioID, file)
+	}
+	if err != nil {
+		w.setStatus(ctx, video, meta.StatusError)
+		return err
+	}
+	w.prepare(ctx, video, tabid, file.Subtitles)
+	return nil
+}
+
+// prepare runs the steps after a download, publishes the audio file and
+// sets video StatusReady
+func (w *Worker) prepare(ctx context.Context, video meta.Video, tabid int, subtitles []provider.Subtitle) {
+	w.process(ctx, video, tabid)
+	err := w.saveSubtitles(ctx, video.ID, subtitles)
+	if err != nil {
+		log.Printf("Error(%s): transcript: %v", video.ID, err)
+	}
+	w.thumbnail(video)
+	w.tag(ctx, video.ID)
+	w.saveSize(ctx, video.AudioID, video.Ext)
+	if video.Split {
+		w.split(ctx, video.ID)
+	}
+	err = w.publish(ctx, video.AudioID, video.Ext)
+	if err != nil {
+		log.Printf("Error(%s): publish: %v", video.ID, err)
+		w.setStatus(ctx, video, meta.StatusError)
+		return
+	}
+	w.setStatus(ctx, video, meta.StatusReady)
+}
+
+// saveSize records the size of the audio file audioID for the storage
+// accounting
+func (w *Worker) saveSize(ctx context.Context, audioID uuid.UUID, ext string) {
+	var size int64
+	info, err := os.Stat(filepath.Join(w.path, fmt.Sprintf("%s.%s", audioID, ext)))
+	if err == nil {
+		size = info.Size()
+	}
+	err = w.db.SetAudioSize(ctx, audioID, size)
+	if err != nil {
+		log.Printf("Error(%s): size: %v", audioID, err)
+	}
+}
+
+// checkSpace fails with ErrDiskFull if the disk of the audio files has
+// less than minFree bytes left
+func (w *Worker) checkSpace() error {
+	if w.minFree <= 0 {
+		return nil
+	}
+	free, err := utils.FreeSpace(w.path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if free < w.minFree {
+		return fmt.Errorf("%w: %d MB free, %d MB required", ErrDiskFull, free>>20, w.minFree>>20)
+	}
+	return nil
+}
+
+// setStatus changes the status of video and of the copies sharing its
+// audio file
+func (w *Worker) setStatus(ctx context.Context, video meta.Video, status meta.Status) {
+	err := w.db.SetAudioStatus(ctx, video.AudioID, status)
+	if err != nil {
+		log.Printf("Error(%s): status %s: %v", video.ID, status, err)
+	}
+}
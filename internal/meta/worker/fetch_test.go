@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+func TestCoordinatorDeduplicates(t *testing.T) {
+	c := newCoordinator(2)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	errFetch := errors.New("fetch failed")
+
+	// all callers join before the running call can finish
+	results := make([]<-chan singleflight.Result, 20)
+	for i := range results {
+		results[i] = c.join("audio", func() error {
+			calls.Add(1)
+			<-release
+			return errFetch
+		})
+	}
+	close(release)
+
+	for i, ch := range results {
+		res := <-ch
+		if !errors.Is(res.Err, errFetch) || !res.Shared {
+			t.Errorf("caller %d got %v (shared %v), want the shared error", i, res.Err, res.Shared)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fn ran %d times, want 1", n)
+	}
+}
+
+func TestCoordinatorLimit(t *testing.T) {
+	const limit = 3
+	c := newCoordinator(limit)
+	var running, peak atomic.Int32
+
+	var wg sync.WaitGroup
+	for i := range 12 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.do(context.Background(), fmt.Sprint(i), func() error {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p > limit || p == 0 {
+		t.Errorf("peak concurrency %d, want 1..%d", p, limit)
+	}
+}
+
+func TestCoordinatorContext(t *testing.T) {
+	c := newCoordinator(1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		_ = c.do(context.Background(), "audio", func() error {
+			close(started)
+			<-release
+			close(done)
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := c.do(ctx, "audio", func() error {
+		t.Error("second call ran while the first was running")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("do() = %v, want deadline exceeded", err)
+	}
+	// the running call is not cancelled by a waiting caller giving up
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("running call did not finish")
+	}
+}
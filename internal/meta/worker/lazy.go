@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+)
+
+// evictEvery is how often idle audio files of lazy tabs are looked for
+const evictEvery = time.Hour
+
+// onDemand lists video of a lazy tab without downloading its audio. The
+// artwork is small and fetched right away for the feed.
+func (w *Worker) onDemand(ctx context.Context, video meta.Video, tab meta.Tab) {
+	w.thumbnail(video)
+	if ext := tab.Audio.Format.Ext(); ext != "" {
+		err := w.db.SetAudioFile(ctx, video.AudioID, provider.AudioFile{Ext: ext})
+		if err != nil {
+			log.Printf("Error(%s): on demand: %v", video.ID, err)
+		}
+	}
+	w.setStatus(ctx, video, meta.StatusOnDemand)
+}
+
+// startEviction removes idle audio files of lazy tabs until the workers
+// are closed
+func (w *Worker) startEviction(idle time.Duration) {
+	ticker := time.NewTicker(evictEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.evictIdle(context.Background(), idle)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// evictIdle removes the audio files of lazy tabs which were not requested
+// for idle. The videos stay in the feed and download again on request.
+func (w *Worker) evictIdle(ctx context.Context, idle time.Duration) {
+	audio, err := w.db.IdleAudio(ctx, time.Now().Add(-idle))
+	if err != nil {
+		log.Printf("Error: evict: %v", err)
+		return
+	}
+	for _, a := range audio {
+		// requests for missing audio fetch it again whatever the status
+		err = w.store.Delete(ctx, fmt.Sprintf("%s.%s", a.AudioID, a.Ext))
+		if err != nil {
+			log.Printf("Error(%s): evict: %v", a.AudioID, err)
+			continue
+		}
+		err = w.db.SetAudioStatus(ctx, a.AudioID, meta.StatusOnDemand)
+		if err == nil {
+			err = w.db.SetAudioSize(ctx, a.AudioID, 0)
+		}
+		if err != nil {
+			log.Printf("Error(%s): evict: %v", a.AudioID, err)
+			continue
+		}
+		log.Printf("evicted idle audio %s", a.AudioID)
+	}
+}
@@ -0,0 +1,236 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"tubefeed/internal/gc"
+	"tubefeed/internal/media"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+)
+
+// streamWait is how long a request waits for a streamed download to start,
+// e.g. while all workers are busy
+const streamWait = 10 * time.Second
+
+// Live is an audio file which is still being written. Its readers follow
+// the writer until the download ends.
+type Live struct {
+	ContentType string
+
+	f    *os.File
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int64
+	done bool
+	err  error
+	refs int // the writer and open readers, the last one closes f
+}
+
+func newLive(path, contentType string) (*Live, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &Live{ContentType: contentType, f: f, refs: 1}
+	l.cond = sync.NewCond(&l.mu)
+	return l, nil
+}
+
+func (l *Live) Write(p []byte) (int, error) {
+	n, err := l.f.Write(p)
+	l.mu.Lock()
+	l.size += int64(n)
+	l.mu.Unlock()
+	l.cond.Broadcast()
+	return n, err
+}
+
+// finish ends the file, readers get err after the written data
+func (l *Live) finish(err error) {
+	l.mu.Lock()
+	l.done, l.err = true, err
+	l.mu.Unlock()
+	l.cond.Broadcast()
+	l.release()
+}
+
+func (l *Live) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		_ = l.f.Close()
+	}
+}
+
+// NewReader reads the file from the start, blocking for data which is not
+// written yet. It reads the file written so far even if it was renamed.
+func (l *Live) NewReader() io.ReadCloser {
+	l.mu.Lock()
+	l.refs++
+	l.mu.Unlock()
+	return &liveReader{live: l}
+}
+
+type liveReader struct {
+	live   *Live
+	off    int64
+	closed bool
+}
+
+func (r *liveReader) Read(p []byte) (int, error) {
+	l := r.live
+	l.mu.Lock()
+	for r.off >= l.size && !l.done {
+		l.cond.Wait()
+	}
+	size, err := l.size, l.err
+	l.mu.Unlock()
+	if r.off >= size {
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	n, err := l.f.ReadAt(p[:min(int64(len(p)), size-r.off)], r.off)
+	r.off += int64(n)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *liveReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.live.release()
+	}
+	return nil
+}
+
+// Stream returns the audio of video while it downloads. It joins a
+// streamed download or starts one, nil means the audio can't be streamed
+// now and the download continues in the background.
+func (w *Worker) Stream(ctx context.Context, video meta.Video, tabid int) *Live {
+	key := video.AudioID.String()
+	if live, ok := w.lives.Load(key); ok {
+		return live.(*Live)
+	}
+	// a worker is downloading it without streaming
+	if video.Status == meta.StatusLoading {
+		go w.fetchInBackground(video, tabid)
+		return nil
+	}
+	started := make(chan *Live, 1)
+	go func() {
+		err := w.fetches.do(context.Background(), key, func() error {
+			return w.fetchStream(context.Background(), video, tabid, started)
+		})
+		if err != nil {
+			log.Printf("Error(%s): %v", video.ID, err)
+		}
+		// joined a download which does not stream
+		select {
+		case started <- nil:
+		default:
+		}
+	}()
+	select {
+	case live := <-started:
+		return live
+	case <-time.After(streamWait):
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func (w *Worker) fetchInBackground(video meta.Video, tabid int) {
+	err := w.Fetch(context.Background(), video, tabid)
+	if err != nil {
+		log.Printf("Error(%s): %v", video.ID, err)
+	}
+}
+
+// fetchStream is fetch for a listener waiting for the audio. The audio is
+// encoded in the cache while it downloads and announced on started. The
+// listener gets the SponsorBlock segments, they are cut from the stored
+// file once it is complete. Audio which can't be streamed is fetched as
+// usual.
+func (w *Worker) fetchStream(ctx context.Context, video meta.Video, tabid int, started chan<- *Live) error {
+	opts := w.audioOptions(ctx, tabid)
+	ext := opts.Format.Ext()
+	if !media.Streamable(ext) {
+		started <- nil
+		return w.fetch(ctx, video, tabid)
+	}
+	err := w.checkSpace()
+	if err != nil {
+		started <- nil
+		w.setStatus(ctx, video, meta.StatusError)
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	src, ok, err := video.Stream(ctx)
+	if err != nil || !ok {
+		started <- nil
+		if err != nil {
+			log.Printf("Error(%s): stream: %v", video.ID, err)
+		}
+		return w.fetch(ctx, video, tabid)
+	}
+
+	w.setStatus(ctx, video, meta.StatusLoading)
+	cache := filepath.Join(w.path, gc.CacheDir)
+	audio := filepath.Join(cache, fmt.Sprintf("%s.%s", video.AudioID, ext))
+	err = os.MkdirAll(cache, 0o755)
+	var live *Live
+	if err == nil {
+		live, err = newLive(audio+".part", media.ContentType(ext))
+	}
+	if err != nil {
+		_ = src.Close()
+		started <- nil
+		w.setStatus(ctx, video, meta.StatusError)
+		return err
+	}
+	key := video.AudioID.String()
+	w.lives.Store(key, live)
+	defer w.lives.Delete(key)
+	started <- live
+
+	err = media.Transcode(ctx, src, live, ext, opts.Bitrate, opts.Channels, opts.SampleRate)
+	// closing waits for the source, it reports its own failures
+	if cerr := src.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(audio+".part", audio)
+	}
+	live.finish(err)
+	var file provider.AudioFile
+	if err == nil {
+		file, err = video.FinishStream(audio, w.path, opts)
+	}
+	if err == nil {
+		err = w.db.SetAudioFile(ctx, video.AudioID, file)
+	}
+	if err != nil {
+		_ = os.Remove(audio + ".part")
+		_ = os.Remove(audio)
+		w.setStatus(ctx, video, meta.StatusError)
+		return err
+	}
+	video.Ext = file.Ext
+	w.prepare(ctx, video, tabid, file.Subtitles)
+	return nil
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLive(t *testing.T) {
+	dir := t.TempDir()
+	part := filepath.Join(dir, "audio.mp3.part")
+	live, err := newLive(part, "audio/mpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	var wg sync.WaitGroup
+	got := make([][]byte, 4)
+	for i := range got {
+		wg.Add(1)
+		r := live.NewReader()
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			var err error
+			got[i], err = io.ReadAll(r)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for i := range 100 {
+		chunk := bytes.Repeat([]byte{byte(i)}, 1000+i)
+		want.Write(chunk)
+		if _, err := live.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// readers keep the file open when it is renamed
+	err = os.Rename(part, filepath.Join(dir, "audio.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.finish(nil)
+	wg.Wait()
+	for i := range got {
+		if !bytes.Equal(got[i], want.Bytes()) {
+			t.Errorf("reader %d got %d bytes, want %d", i, len(got[i]), want.Len())
+		}
+	}
+}
+
+func TestLiveError(t *testing.T) {
+	live, err := newLive(filepath.Join(t.TempDir(), "audio.part"), "audio/mpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := live.NewReader()
+	defer r.Close()
+	live.Write([]byte("partial"))
+	failed := errors.New("download failed")
+	live.finish(failed)
+	b, err := io.ReadAll(r)
+	if string(b) != "partial" || !errors.Is(err, failed) {
+		t.Errorf("got %q, %v, want partial data and the download error", b, err)
+	}
+}
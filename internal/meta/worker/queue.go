@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"tubefeed/internal/meta"
+)
+
+// startFeeder queues the downloads waiting in the database whenever
+// Download signals them, until the workers are closed
+func (w *Worker) startFeeder() {
+	for {
+		select {
+		case <-w.waiting:
+			w.feed(context.Background())
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// feed queues the videos with StatusNew which are not queued yet, it
+// blocks until the queue has room for them
+func (w *Worker) feed(ctx context.Context) {
+	videos, err := w.db.AllVideos(ctx)
+	if err != nil {
+		log.Printf("Error: queue: %v", err)
+		return
+	}
+	for _, video := range videos {
+		if video.Status != meta.StatusNew {
+			continue
+		}
+		// the video may have been queued, downloaded or deleted meanwhile
+		if _, ok := w.queued.Load(video.ID); ok {
+			continue
+		}
+		video, err = w.db.GetVideo(ctx, video.ID)
+		if err != nil || video.Status != meta.StatusNew {
+			continue
+		}
+		w.queued.Store(video.ID, struct{}{})
+		select {
+		case w.req <- Request{Video: video, Tabid: video.Tabid}:
+			log.Printf("Work Queued: %s", video.Meta.URL)
+		case <-w.done:
+			return
+		}
+	}
+}
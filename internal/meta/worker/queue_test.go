@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"tubefeed/internal/db"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+
+	"github.com/google/uuid"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFeed(t *testing.T) {
+	ctx := context.Background()
+	database, closedb, err := db.NewDatabase(filepath.Join(t.TempDir(), "tubefeed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closedb()
+	w := Worker{req: make(chan Request, 10), queued: &sync.Map{}, done: make(chan struct{}), db: database}
+
+	videos := make([]meta.Video, 4)
+	for i, status := range []meta.Status{meta.StatusNew, meta.StatusNew, meta.StatusNew, meta.StatusReady} {
+		id := uuid.New()
+		videos[i] = meta.Video{ID: id, AudioID: id, Ext: "mp3", Meta: provider.VideoMeta{URL: "https://example.com/" + id.String()}}
+		err = database.SaveVideoMetadata(ctx, videos[i], 1, status)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// already in the queue
+	w.queued.Store(videos[0].ID, struct{}{})
+
+	w.feed(ctx)
+	close(w.req)
+	got := make(map[uuid.UUID]int)
+	for r := range w.req {
+		got[r.Video.ID]++
+		if r.Tabid != 1 {
+			t.Errorf("%s queued for tab %d, want 1", r.Video.ID, r.Tabid)
+		}
+	}
+	if len(got) != 2 || got[videos[1].ID] != 1 || got[videos[2].ID] != 1 {
+		t.Errorf("queued %v, want the waiting videos %s and %s", got, videos[1].ID, videos[2].ID)
+	}
+}
+
+func TestFeedSkipsRunningJobs(t *testing.T) {
+	ctx := context.Background()
+	database, closedb, err := db.NewDatabase(filepath.Join(t.TempDir(), "tubefeed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closedb()
+	w := Worker{req: make(chan Request, 1), queued: &sync.Map{}, waiting: make(chan struct{}, 1), done: make(chan struct{}), db: database}
+
+	id := uuid.New()
+	video := meta.Video{ID: id, AudioID: id, Ext: "mp3", Meta: provider.VideoMeta{URL: "https://example.com/" + id.String()}}
+	err = database.SaveVideoMetadata(ctx, video, 1, meta.StatusNew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Download(video, 1)
+	// a worker took the job and is still loading the metadata
+	r := <-w.req
+	w.feed(ctx)
+	if len(w.req) != 0 {
+		t.Fatal("running job queued again")
+	}
+
+	// the unsupported url fails the job, it leaves StatusNew
+	w.download(ctx, 0, r)
+	w.feed(ctx)
+	if len(w.req) != 0 {
+		t.Error("finished job queued again")
+	}
+	if _, ok := w.queued.Load(id); ok {
+		t.Error("finished job still queued")
+	}
+	got, err := database.GetVideo(ctx, id)
+	if err != nil || got.Status != meta.StatusError {
+		t.Errorf("status = %s, %v, want %s", got.Status, err, meta.StatusError)
+	}
+}
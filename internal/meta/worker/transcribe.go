@@ -0,0 +1,187 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"tubefeed/internal/meta"
+	"tubefeed/internal/storage"
+	"tubefeed/internal/transcript"
+
+	"github.com/google/uuid"
+)
+
+// SpeechToText configures transcribing videos without subtitles with a
+// local command, e.g. whisper.cpp:
+//
+//	whisper-cli -m ggml-base.bin -l {lang} -ovtt -of {output} -f {audio}
+//
+// {audio} is the audio file, {lang} the language and the command must
+// write {output}.vtt or {output}.json.
+type SpeechToText struct {
+	Command string // empty disables transcription
+	Lang    string
+	Workers int
+}
+
+// startTranscriber runs transcription jobs. It has its own queue, a slow
+// transcription doesn't hold up downloads.
+func (w *Worker) startTranscriber(id int) {
+	log.Printf("transcriber %d started.", id)
+	ctx := context.Background()
+	for videoID := range w.transcribe {
+		err := w.speechToText(ctx, videoID)
+		if err != nil {
+			// failed jobs stay marked and are retried after a restart
+			log.Printf("Error(transcriber %d): %v", id, err)
+			continue
+		}
+		w.transcribing.Delete(videoID)
+	}
+	log.Printf("transcriber %d stopped.", id)
+}
+
+// queueTranscription queues video id for speech-to-text if it is set up.
+// If the queue is full the video waits in the database.
+func (w *Worker) queueTranscription(id uuid.UUID) {
+	if w.stt.Command == "" {
+		return
+	}
+	if _, ok := w.transcribing.LoadOrStore(id, struct{}{}); ok {
+		return
+	}
+	select {
+	case w.transcribe <- id:
+		log.Printf("Transcription Queued: %s", id)
+	default:
+		w.transcribing.Delete(id)
+		log.Printf("Transcription Queue is full, %s waits", id)
+		select {
+		case w.untranscribed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// startTranscriptionFeeder queues the transcriptions waiting in the
+// database whenever queueTranscription signals them, until the workers
+// are closed
+func (w *Worker) startTranscriptionFeeder() {
+	for {
+		select {
+		case <-w.untranscribed:
+			w.feedTranscriptions(context.Background())
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// feedTranscriptions queues the available videos without transcript which
+// are not queued yet, it blocks until the queue has room for them
+func (w *Worker) feedTranscriptions(ctx context.Context) {
+	videos, err := w.db.AllVideos(ctx)
+	if err != nil {
+		log.Printf("Error: transcription queue: %v", err)
+		return
+	}
+	for _, video := range videos {
+		if video.Status != meta.StatusReady || video.TranscriptLang != "" {
+			continue
+		}
+		if _, ok := w.transcribing.LoadOrStore(video.ID, struct{}{}); ok {
+			continue
+		}
+		select {
+		case w.transcribe <- video.ID:
+			log.Printf("Transcription Queued: %s", video.ID)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// speechToText transcribes the audio file of video id. The audio is
+// already cut and processed, so the times need no mapping.
+func (w *Worker) speechToText(ctx context.Context, id uuid.UUID) error {
+	video, err := w.db.GetVideo(ctx, id)
+	if err != nil {
+		return err
+	}
+	if video.TranscriptLang != "" {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "tubefeed-stt")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// published audio is restored for the command, the copy is not needed
+	// afterwards
+	name := fmt.Sprintf("%s.%s", video.AudioID, video.Ext)
+	restored, err := storage.Restore(ctx, w.store, w.path, name)
+	if err != nil {
+		return err
+	}
+	audio := filepath.Join(w.path, name)
+	if restored {
+		defer os.Remove(audio)
+	}
+	output := filepath.Join(dir, video.AudioID.String())
+	args := sttArgs(w.stt.Command, audio, output, w.stt.Lang)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	log.Printf("⏳ transcribing %s: %s", video.Meta.Title, cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: failed cmd %s: %v: %s", transcript.ErrTranscript, cmd, err, out)
+	}
+
+	lang := w.stt.Lang
+	var cues []transcript.Cue
+	if f, err := os.Open(output + ".vtt"); err == nil {
+		defer f.Close()
+		cues, err = transcript.ParseVTT(f)
+		if err != nil {
+			return err
+		}
+	} else if f, err := os.Open(output + ".json"); err == nil {
+		defer f.Close()
+		var detected string
+		cues, detected, err = transcript.ParseJSON(f)
+		if err != nil {
+			return err
+		}
+		if detected != "" {
+			lang = detected
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s wrote neither %s.vtt nor %s.json", transcript.ErrTranscript, cmd, output, output)
+	} else {
+		return err
+	}
+	err = w.saveTranscript(ctx, video.AudioID, lang, cues)
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ transcribed %s", video.Meta.Title)
+	return nil
+}
+
+// sttArgs splits command into arguments and fills in the placeholders.
+// Splitting first keeps paths with spaces in one argument.
+func sttArgs(command, audio, output, lang string) []string {
+	r := strings.NewReplacer("{audio}", audio, "{output}", output, "{lang}", lang)
+	args := strings.Fields(command)
+	for i, arg := range args {
+		args[i] = r.Replace(arg)
+	}
+	return args
+}
@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"tubefeed/internal/db"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+
+	"github.com/google/uuid"
+)
+
+func TestSTTArgs(t *testing.T) {
+	got := sttArgs("whisper-cli -l {lang} -ovtt -of {output} -f {audio}", "/my audio/a.mp3", "/tmp/out", "de")
+	want := []string{"whisper-cli", "-l", "de", "-ovtt", "-of", "/tmp/out", "-f", "/my audio/a.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sttArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestQueueTranscription(t *testing.T) {
+	ctx := context.Background()
+	database, closedb, err := db.NewDatabase(filepath.Join(t.TempDir(), "tubefeed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closedb()
+	w := Worker{
+		transcribe:    make(chan uuid.UUID, 1),
+		stt:           SpeechToText{Command: "whisper-cli"},
+		transcribing:  &sync.Map{},
+		untranscribed: make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		db:            database,
+	}
+
+	videos := make([]meta.Video, 5)
+	for i, status := range []meta.Status{meta.StatusReady, meta.StatusReady, meta.StatusReady, meta.StatusNew, meta.StatusOnDemand} {
+		id := uuid.New()
+		videos[i] = meta.Video{ID: id, AudioID: id, Ext: "mp3", Meta: provider.VideoMeta{URL: "https://example.com/" + id.String()}}
+		err = database.SaveVideoMetadata(ctx, videos[i], 1, status)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = database.SetTranscript(ctx, videos[2].AudioID, "en", "already transcribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.queueTranscription(videos[0].ID)
+	w.queueTranscription(videos[0].ID)
+	// the queue is full, the second video waits in the database
+	w.queueTranscription(videos[1].ID)
+	if len(w.transcribe) != 1 || len(w.untranscribed) != 1 {
+		t.Fatalf("queued %d, signaled %d, want 1 and 1", len(w.transcribe), len(w.untranscribed))
+	}
+	if got := <-w.transcribe; got != videos[0].ID {
+		t.Errorf("queued %s, want %s", got, videos[0].ID)
+	}
+
+	<-w.untranscribed
+	w.transcribe = make(chan uuid.UUID, 10)
+	w.feedTranscriptions(ctx)
+	close(w.transcribe)
+	var got []uuid.UUID
+	for id := range w.transcribe {
+		got = append(got, id)
+	}
+	if len(got) != 1 || got[0] != videos[1].ID {
+		t.Errorf("fed %v, want the waiting video %s", got, videos[1].ID)
+	}
+}
@@ -4,9 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"tubefeed/internal/db"
+	"tubefeed/internal/media"
 	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+	"tubefeed/internal/storage"
+	"tubefeed/internal/transcript"
 
 	"github.com/google/uuid"
 )
@@ -14,21 +22,74 @@ import (
 type Request struct {
 	Video meta.Video
 	Tabid int
+	Retag bool // only rewrite the tags of the downloaded audio file
 }
 
 type Worker struct {
-	req  chan Request
-	db   *db.Database
-	path string
+	req           chan Request
+	transcribe    chan uuid.UUID // videos waiting for speech-to-text
+	stt           SpeechToText
+	fetches       *coordinator  // audio downloads of workers and http requests
+	lives         *sync.Map     // audio id -> *Live of streamed downloads
+	queued        *sync.Map     // video id -> struct{} of downloads in req
+	waiting       chan struct{} // signals downloads left in the database
+	transcribing  *sync.Map     // video id -> struct{} of jobs in transcribe
+	untranscribed chan struct{} // signals transcriptions left in the database
+	done          chan struct{} // stops the background loops
+	db            *db.Database
+	path          string          // audio files are prepared here
+	store         storage.Storage // and published here
+	minFree       int64           // bytes kept free on the disk of path
 }
 
-func CreateWorkers(count int, db *db.Database, path string) (w Worker, closefn func()) {
-	req := make(chan Request, 20)
-	w = Worker{req: req}
+// queueSize is the number of downloads waiting for a free worker, more
+// wait in the database until the queue has room
+const queueSize = 200
+
+func CreateWorkers(count int, db *db.Database, path string, stt SpeechToText, evictAfter time.Duration, minFree int64, store storage.Storage) (w Worker, closefn func()) {
+	req := make(chan Request, queueSize)
+	transcribe := make(chan uuid.UUID, queueSize)
+	fetches := newCoordinator(count)
+	done := make(chan struct{})
+	lives := &sync.Map{}
+	queued := &sync.Map{}
+	waiting := make(chan struct{}, 1)
+	transcribing := &sync.Map{}
+	untranscribed := make(chan struct{}, 1)
+	// goroutines share w, it is complete before they start
+	w = Worker{req: req, transcribe: transcribe, stt: stt, fetches: fetches, lives: lives, queued: queued, waiting: waiting, transcribing: transcribing, untranscribed: untranscribed, done: done, db: db, path: path, store: store, minFree: minFree}
 	for i := range count {
 		go w.start(i)
 	}
-	return Worker{req: req, db: db, path: path}, func() { close(req) }
+	// downloads left from the last run are queued at startup
+	waiting <- struct{}{}
+	var feeding sync.WaitGroup
+	feeding.Add(1)
+	go func() {
+		defer feeding.Done()
+		w.startFeeder()
+	}()
+	if stt.Command != "" {
+		for i := range max(stt.Workers, 1) {
+			go w.startTranscriber(i)
+		}
+		// and audio files left without transcript
+		untranscribed <- struct{}{}
+		feeding.Add(1)
+		go func() {
+			defer feeding.Done()
+			w.startTranscriptionFeeder()
+		}()
+	}
+	if evictAfter > 0 {
+		go w.startEviction(evictAfter)
+	}
+	return w, func() {
+		close(done)
+		feeding.Wait()
+		close(req)
+		close(transcribe)
+	}
 }
 
 func (w *Worker) handleError(ctx context.Context, workerID int, videoID uuid.UUID, err error) {
@@ -44,45 +105,268 @@ func (w *Worker) start(id int) {
 	ctx := context.Background()
 	for r := range w.req {
 		log.Printf("worker %d started job %s", id, r.Video.Meta.Title)
-		// save id & url to db -> StatusNew
-		err := r.Video.LoadMeta()
-		if err != nil {
-			w.handleError(ctx, id, r.Video.ID, err)
+		if r.Retag {
+			w.retag(ctx, r.Video)
 			continue
 		}
+		w.download(ctx, id, r)
+	}
+	log.Printf("worker %d stopped.", id)
+}
+
+// download loads the metadata of the requested video and its audio. The
+// video stays queued until its row has left StatusNew, so it is not
+// queued again from the database meanwhile.
+func (w *Worker) download(ctx context.Context, id int, r Request) {
+	// save id & url to db -> StatusNew
+	err := r.Video.LoadMeta()
+	if err == nil {
 		// save meta to db -> StateMeta
 		err = w.db.SaveVideoMetadata(ctx, r.Video, r.Tabid, meta.StatusMeta)
-		if err != nil {
-			w.handleError(ctx, id, r.Video.ID, err)
+	}
+	if err != nil {
+		w.handleError(ctx, id, r.Video.ID, err)
+	}
+	w.queued.Delete(r.Video.ID)
+	if err != nil {
+		return
+	}
+	// lazy tabs download the audio when it is requested -> StatusOnDemand
+	if tab, err := w.db.GetTab(ctx, r.Tabid); err == nil && tab.Lazy {
+		w.onDemand(ctx, r.Video, tab)
+		return
+	}
+	// download & extract audio -> StateLoading, StatusReady
+	err = w.Fetch(ctx, r.Video, r.Tabid)
+	if err != nil {
+		log.Printf("Error(worker %d): %v", id, err)
+	}
+}
+
+// thumbnail stores the artwork of video next to its audio file. Missing
+// artwork is not an error, the feed logo is used instead.
+func (w *Worker) thumbnail(video meta.Video) {
+	if video.Meta.Thumbnail == "" {
+		return
+	}
+	dst := filepath.Join(w.path, fmt.Sprintf("%s.jpg", video.AudioID))
+	err := media.Thumbnail(video.Meta.Thumbnail, dst)
+	if err != nil {
+		log.Printf("Error(%s): thumbnail: %v", video.ID, err)
+	}
+}
+
+// audioOptions returns the audio profile of tab, tabs without settings
+// use the defaults
+func (w *Worker) audioOptions(ctx context.Context, tabid int) provider.AudioOptions {
+	tab, err := w.db.GetTab(ctx, tabid)
+	if err != nil {
+		log.Printf("worker: default audio profile for tab %d: %v", tabid, err)
+		return provider.AudioOptions{}
+	}
+	return tab.Audio
+}
+
+// process runs the post-processing pipeline of tab on the downloaded audio
+// and records the outcome. The unprocessed file is still usable, so
+// failures don't fail the video.
+func (w *Worker) process(ctx context.Context, video meta.Video, tabid int) {
+	tab, err := w.db.GetTab(ctx, tabid)
+	if err != nil || tab.Process.Empty() {
+		return
+	}
+	audio := filepath.Join(w.path, fmt.Sprintf("%s.%s", video.AudioID, video.Ext))
+	outcomes := media.Process(audio, tab.Process, tab.Audio.Bitrate, tab.Audio.SampleRate)
+	err = w.db.SetProcessing(ctx, video.AudioID, outcomes)
+	if err != nil {
+		log.Printf("Error(%s): process: %v", video.ID, err)
+	}
+}
+
+// saveSubtitles turns the first of the downloaded subtitles of video id into
+// transcript files next to its audio file and indexes the text. Times
+// follow the cuts and speed of the audio. The subtitles are removed, the
+// audio is usable without a transcript. Videos without subtitles are
+// queued for speech-to-text.
+func (w *Worker) saveSubtitles(ctx context.Context, id uuid.UUID, subtitles []provider.Subtitle) error {
+	defer func() {
+		for _, sub := range subtitles {
+			_ = os.Remove(sub.Path)
+		}
+	}()
+	if len(subtitles) == 0 {
+		w.queueTranscription(id)
+		return nil
+	}
+	video, err := w.db.GetVideo(ctx, id)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(subtitles[0].Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cues, err := transcript.ParseVTT(f)
+	if err != nil {
+		return err
+	}
+	cues = transcript.Map(transcript.Clean(cues), video.AudioTime)
+	return w.saveTranscript(ctx, video.AudioID, subtitles[0].Lang, cues)
+}
+
+// saveTranscript stores cues as the transcript of audio file audioID
+func (w *Worker) saveTranscript(ctx context.Context, audioID uuid.UUID, lang string, cues []transcript.Cue) error {
+	err := transcript.WriteFiles(filepath.Join(w.path, audioID.String()), cues)
+	if err != nil {
+		return err
+	}
+	return w.db.SetTranscript(ctx, audioID, lang, transcript.Text(cues))
+}
+
+// tag writes the metadata of video id into its audio file. The album is
+// the tab the original of the file is in now, it may have been moved while
+// downloading. Copies share the file and its album. Untagged files still
+// play, so failures are only logged.
+func (w *Worker) tag(ctx context.Context, id uuid.UUID) {
+	video, err := w.db.GetVideo(ctx, id)
+	if err != nil {
+		log.Printf("Error(%s): tag: %v", id, err)
+		return
+	}
+	tags := media.Tags{
+		Title:   video.Meta.Title,
+		Artist:  video.Meta.Channel,
+		Date:    video.Meta.UploadDate,
+		Comment: video.Meta.URL,
+	}
+	for _, ch := range video.Meta.Chapters {
+		tags.Chapters = append(tags.Chapters, provider.Chapter{
+			Start: video.AudioTime(ch.Start),
+			End:   video.AudioTime(ch.End),
+			Title: ch.Title,
+		})
+	}
+	original := video
+	if video.AudioID != video.ID {
+		original, err = w.db.GetVideo(ctx, video.AudioID)
+	}
+	if err == nil {
+		tab, err := w.db.GetTab(ctx, original.Tabid)
+		if err == nil {
+			tags.Album = tab.Name
+		}
+	}
+	cover := filepath.Join(w.path, fmt.Sprintf("%s.jpg", video.AudioID))
+	if _, err := os.Stat(cover); err == nil {
+		tags.Cover = cover
+	}
+	audio := filepath.Join(w.path, fmt.Sprintf("%s.%s", video.AudioID, video.Ext))
+	err = media.Tag(audio, tags)
+	if err != nil {
+		log.Printf("Error(%s): tag: %v", id, err)
+	}
+}
+
+// split creates a child episode with its own audio file for each chapter
+// of video id. Videos split before are skipped.
+func (w *Worker) split(ctx context.Context, id uuid.UUID) {
+	parent, err := w.db.GetVideo(ctx, id)
+	if err != nil {
+		log.Printf("Error(%s): split: %v", id, err)
+		return
+	}
+	if len(parent.Meta.Chapters) < 2 {
+		log.Printf("not splitting %s without chapters", parent.Meta.Title)
+		return
+	}
+	children, err := w.db.Children(ctx, id)
+	if err != nil || len(children) > 0 {
+		return
+	}
+	src := filepath.Join(w.path, fmt.Sprintf("%s.%s", parent.AudioID, parent.Ext))
+	cover := filepath.Join(w.path, fmt.Sprintf("%s.jpg", parent.AudioID))
+	for i, ch := range parent.Meta.Chapters {
+		if ch.End <= ch.Start {
 			continue
 		}
-		// download & extract audio -> StateLoading
-		err = w.db.SetStatus(ctx, r.Video.ID, meta.StatusLoading)
+		child := parent.ChapterEpisode(i)
+		dst := filepath.Join(w.path, fmt.Sprintf("%s.%s", child.AudioID, child.Ext))
+		err = media.Extract(src, dst, parent.AudioTime(ch.Start), parent.AudioTime(ch.End))
 		if err != nil {
-			w.handleError(ctx, id, r.Video.ID, err)
-			continue
+			log.Printf("Error(%s): split: %v", id, err)
+			return
+		}
+		err = w.db.SaveVideoMetadata(ctx, child, child.Tabid, meta.StatusReady)
+		if err == nil {
+			err = w.db.SetAudioFile(ctx, child.AudioID, provider.AudioFile{Ext: child.Ext})
 		}
-		err = r.Video.Download(w.path)
 		if err != nil {
-			w.handleError(ctx, id, r.Video.ID, err)
-			continue
+			log.Printf("Error(%s): split: %v", id, err)
+			_ = os.Remove(dst)
+			return
 		}
-		// complete -> StatusReady
-		err = w.db.SetStatus(ctx, r.Video.ID, meta.StatusReady)
+		// children show the artwork of the parent
+		_ = os.Link(cover, filepath.Join(w.path, fmt.Sprintf("%s.jpg", child.AudioID)))
+		w.tag(ctx, child.ID)
+		w.saveSize(ctx, child.AudioID, child.Ext)
+		err = w.publish(ctx, child.AudioID, child.Ext)
 		if err != nil {
-			w.handleError(ctx, id, r.Video.ID, err)
+			log.Printf("Error(%s): split: %v", id, err)
+			w.setStatus(ctx, child, meta.StatusError)
 		}
 	}
-	log.Printf("worker %d stopped.", id)
 }
 
-func (w *Worker) Download(video meta.Video, tabid int) error {
-	// TODO: check video request is ok?
+// retag tags a published audio file again, it is restored from the
+// storage for that
+func (w *Worker) retag(ctx context.Context, video meta.Video) {
+	name := fmt.Sprintf("%s.%s", video.AudioID, video.Ext)
+	restored, err := storage.Restore(ctx, w.store, w.path, name)
+	if err != nil {
+		log.Printf("Error(%s): tag: %v", video.ID, err)
+		return
+	}
+	w.tag(ctx, video.ID)
+	if restored {
+		w.saveSize(ctx, video.AudioID, video.Ext)
+		err = w.publish(ctx, video.AudioID, video.Ext)
+		if err != nil {
+			log.Printf("Error(%s): tag: %v", video.ID, err)
+		}
+	}
+}
+
+// publish moves the prepared audio file audioID into the storage
+func (w *Worker) publish(ctx context.Context, audioID uuid.UUID, ext string) error {
+	return storage.Publish(ctx, w.store, w.path, fmt.Sprintf("%s.%s", audioID, ext))
+}
+
+// Retag queues rewriting the tags of a downloaded video, e.g. after it
+// moved to another tab
+func (w *Worker) Retag(video meta.Video) error {
 	select {
-	case w.req <- Request{Video: video, Tabid: tabid}:
-		log.Printf("Work Queued: %s", video.Meta.URL)
+	case w.req <- Request{Video: video, Tabid: video.Tabid, Retag: true}:
+		log.Printf("Retag Queued: %s", video.Meta.URL)
 		return nil
 	default:
 		return fmt.Errorf("Worker Queue is full")
 	}
 }
+
+// Download queues a download of video, which is saved as StatusNew. If
+// the queue is full it waits in the database until there is room.
+func (w *Worker) Download(video meta.Video, tabid int) {
+	w.queued.Store(video.ID, struct{}{})
+	select {
+	case w.req <- Request{Video: video, Tabid: tabid}:
+		log.Printf("Work Queued: %s", video.Meta.URL)
+	default:
+		w.queued.Delete(video.ID)
+		log.Printf("Work Queue is full, %s waits", video.Meta.URL)
+		select {
+		case w.waiting <- struct{}{}:
+		default:
+		}
+	}
+}
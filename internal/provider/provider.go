@@ -1,6 +1,9 @@
 package provider
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,9 +13,85 @@ type ProviderNewVideoFn func(url string) (VideoProvider, error)
 
 // VideoProvider can handle Videos of a domain
 type VideoProvider interface {
-	LoadMetadata() (*VideoMeta, error)            // Provider starts requesting metadata
-	Download(id uuid.UUID, basepath string) error // Provider must download audio atomicly to Path
-	Url() string                                  // Url to Website of specific Video
+	LoadMetadata() (*VideoMeta, error) // Provider starts requesting metadata
+	// Provider must download audio atomicly to Path
+	Download(id uuid.UUID, basepath string, opts AudioOptions) (AudioFile, error)
+	Url() string // Url to Website of specific Video
+}
+
+// Streamer is implemented by providers which can write the audio of a
+// video to a pipe while it downloads
+type Streamer interface {
+	// Stream returns the best audio of the video in its original format,
+	// Close waits for the download to end
+	Stream(ctx context.Context) (io.ReadCloser, error)
+	// Finish moves the complete streamed audio file to basepath as
+	// Download would have left it, with segments cut and subtitles
+	Finish(id uuid.UUID, file string, basepath string, opts AudioOptions) (AudioFile, error)
+}
+
+// AudioFormat is the format audio files are stored in
+type AudioFormat string
+
+var (
+	FormatMP3      AudioFormat = "mp3"
+	FormatM4A      AudioFormat = "m4a" // aac
+	FormatOpus     AudioFormat = "opus"
+	FormatOriginal AudioFormat = "original" // as published, not re-encoded
+)
+
+// ParseAudioFormat returns the AudioFormat named s
+func ParseAudioFormat(s string) (AudioFormat, error) {
+	format := AudioFormat(s)
+	switch format {
+	case FormatMP3, FormatM4A, FormatOpus, FormatOriginal:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown audio format: %q", s)
+}
+
+// Ext returns the extension of files in format, unknown for the original
+// format until it is downloaded
+func (f AudioFormat) Ext() string {
+	switch f {
+	case "":
+		return string(FormatMP3)
+	case FormatOriginal:
+		return ""
+	}
+	return string(f)
+}
+
+// AudioOptions select the audio profile of a download. Zero values keep
+// the defaults of the encoder or the source.
+type AudioOptions struct {
+	Format     AudioFormat
+	Bitrate    int // kbit/s
+	Channels   int // 1 mono, 2 stereo
+	SampleRate int // Hz
+	// RemoveCategories are the SponsorBlock categories cut from the audio
+	RemoveCategories []string
+}
+
+// AudioFile describes a downloaded audio file
+type AudioFile struct {
+	Ext string    // extension of the file
+	Cut []Segment // parts of the video removed from the audio, in order
+	// Subtitles written next to the audio file, preferred language first
+	Subtitles []Subtitle
+}
+
+// Subtitle is a WebVTT subtitle file of a video
+type Subtitle struct {
+	Lang string
+	Path string
+}
+
+// Segment is a part of a video
+type Segment struct {
+	Start    time.Duration `json:"start"`
+	End      time.Duration `json:"end"`
+	Category string        `json:"category"`
 }
 
 type VideoMeta struct {
@@ -22,4 +101,16 @@ type VideoMeta struct {
 	Length      time.Duration
 	Description string
 	URL         string
+	UploadDate  time.Time
+	Thumbnail   string // URL of the thumbnail image
+	Tags        []string
+	Categories  []string
+	ViewCount   int64
+	Chapters    []Chapter
+}
+
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration
+	Title string
 }
@@ -0,0 +1,93 @@
+package yt
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"time"
+	"tubefeed/internal/provider"
+)
+
+// SponsorBlockAPI is the base url of the SponsorBlock server
+var SponsorBlockAPI = "https://sponsor.ajay.app"
+
+// SponsorBlockCategories are the categories of segments SponsorBlock knows
+var SponsorBlockCategories = []string{
+	"sponsor", "selfpromo", "interaction", "intro", "outro", "preview", "music_offtopic", "filler",
+}
+
+var sponsorClient = &http.Client{Timeout: 15 * time.Second}
+
+// sponsorSegment is an entry of the skipSegments response
+type sponsorSegment struct {
+	Segment  [2]float64 `json:"segment"`
+	Category string     `json:"category"`
+}
+
+// sponsorSegments fetches the skip segments of ytid in categories from
+// SponsorBlockAPI. Overlapping segments are merged, a video without
+// segments returns none.
+func sponsorSegments(ytid string, categories []string) ([]provider.Segment, error) {
+	cats, err := json.Marshal(categories)
+	if err != nil {
+		return nil, err
+	}
+	query := neturl.Values{
+		"videoID":    {ytid},
+		"categories": {string(cats)},
+		"actionType": {"skip"},
+	}
+	resp, err := sponsorClient.Get(strings.TrimSuffix(SponsorBlockAPI, "/") + "/api/skipSegments?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("%w: sponsorblock: %v", ErrYoutube, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: sponsorblock: %s", ErrYoutube, resp.Status)
+	}
+	var result []sponsorSegment
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("%w: sponsorblock: %v", ErrYoutube, err)
+	}
+
+	var segments []provider.Segment
+	for _, s := range result {
+		if s.Segment[1] <= s.Segment[0] {
+			continue
+		}
+		segments = append(segments, provider.Segment{
+			Start:    seconds(s.Segment[0]),
+			End:      seconds(s.Segment[1]),
+			Category: s.Category,
+		})
+	}
+	return mergeSegments(segments), nil
+}
+
+// mergeSegments sorts segments and joins overlapping ones
+func mergeSegments(segments []provider.Segment) []provider.Segment {
+	slices.SortFunc(segments, func(a, b provider.Segment) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	var merged []provider.Segment
+	for _, s := range segments {
+		if n := len(merged); n > 0 && s.Start <= merged[n-1].End {
+			last := &merged[n-1]
+			last.End = max(last.End, s.End)
+			if !slices.Contains(strings.Split(last.Category, ","), s.Category) {
+				last.Category += "," + s.Category
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
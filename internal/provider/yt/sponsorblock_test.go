@@ -0,0 +1,79 @@
+package yt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tubefeed/internal/provider"
+)
+
+// mockSponsorBlock serves skipSegments for video abc123 and 404 for others
+func mockSponsorBlock(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/skipSegments" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("actionType") != "skip" || q.Get("categories") != `["sponsor","intro"]` {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		if q.Get("videoID") != "abc123" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"segment": [120.5, 180], "category": "sponsor", "UUID": "b", "actionType": "skip"},
+			{"segment": [0, 10], "category": "intro", "UUID": "a", "actionType": "skip"},
+			{"segment": [170, 200], "category": "intro", "UUID": "c", "actionType": "skip"}
+		]`))
+	}))
+	t.Cleanup(srv.Close)
+	old := SponsorBlockAPI
+	SponsorBlockAPI = srv.URL
+	t.Cleanup(func() { SponsorBlockAPI = old })
+}
+
+func TestSponsorSegments(t *testing.T) {
+	mockSponsorBlock(t)
+	segments, err := sponsorSegments("abc123", []string{"sponsor", "intro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []provider.Segment{
+		{Start: 0, End: 10 * time.Second, Category: "intro"},
+		{Start: 120500 * time.Millisecond, End: 200 * time.Second, Category: "sponsor,intro"},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("segments = %+v, want %+v", segments, want)
+	}
+	for i := range want {
+		if segments[i] != want[i] {
+			t.Errorf("segments[%d] = %+v, want %+v", i, segments[i], want[i])
+		}
+	}
+}
+
+func TestSponsorSegmentsNone(t *testing.T) {
+	mockSponsorBlock(t)
+	segments, err := sponsorSegments("unknown", []string{"sponsor", "intro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segments != nil {
+		t.Errorf("segments = %+v, want none", segments)
+	}
+}
+
+func TestMergeSegmentsCategories(t *testing.T) {
+	segments := mergeSegments([]provider.Segment{
+		{Start: 0, End: 10 * time.Second, Category: "music_offtopic"},
+		{Start: 5 * time.Second, End: 20 * time.Second, Category: "music"},
+		{Start: 15 * time.Second, End: 30 * time.Second, Category: "music_offtopic"},
+	})
+	if len(segments) != 1 || segments[0].Category != "music_offtopic,music" || segments[0].End != 30*time.Second {
+		t.Errorf("segments = %+v, want one music_offtopic,music segment", segments)
+	}
+}
@@ -1,14 +1,20 @@
 package yt
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	"tubefeed/internal/media"
 	"tubefeed/internal/provider"
 
 	"github.com/google/uuid"
@@ -22,6 +28,10 @@ var (
 	ErrYoutube = errors.New("youtube error")
 )
 
+// SubtitleLangs are the subtitle languages downloaded with the audio, in
+// order of preference. Auto-generated captions are used if there are none.
+var SubtitleLangs = []string{"en"}
+
 // New implements ProviderNewVideoFn
 func New(url string) (provider.VideoProvider, error) {
 	if !strings.Contains(url, "youtube.com") {
@@ -42,60 +52,268 @@ func (y *yt) Url() string {
 	return url(y.ytid)
 }
 
-func (y *yt) Download(id uuid.UUID, path string) error {
+func (y *yt) Download(id uuid.UUID, path string, opts provider.AudioOptions) (provider.AudioFile, error) {
 	_, err := os.Stat(path)
 	if err != nil {
-		return err
+		return provider.AudioFile{}, err
 	}
 	log.Printf("⏳ yt: Starting Download: %s", path)
-	cmd := exec.Command(
-		"yt-dlp",
+	// the audio is prepared in the cache and only moved to path once cut
+	work := filepath.Join(path, ".cache")
+	args := []string{
 		"--quiet",
-		"--extract-audio",
-		"--audio-format", "mp3",
-		"-P", path,
-		"-P", "temp:.cache",
-		"-o", id.String(),
-		y.Url(),
-	)
+		"--print", "after_move:filepath",
+		"-P", work,
+		"-o", id.String() + ".%(ext)s",
+	}
+	args = append(args, audioArgs(opts)...)
+	args = append(args, subtitleArgs(SubtitleLangs)...)
+	cmd := exec.Command("yt-dlp", append(args, y.Url())...)
 	log.Printf("⏳ yt: running cmd:  %s\n", cmd)
-	out, err := cmd.CombinedOutput()
+	out, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("%w: failed cmd %s: %v: %s", ErrYoutube, cmd, err, out)
+		return provider.AudioFile{}, fmt.Errorf("%w: failed cmd %s: %v: %s", ErrYoutube, cmd, err, out)
+	}
+	file := strings.TrimSpace(string(out))
+	ext := strings.TrimPrefix(filepath.Ext(file), ".")
+	if ext == "" {
+		return provider.AudioFile{}, fmt.Errorf("%w: no file written by %s", ErrYoutube, cmd)
 	}
 	log.Printf("✅ yt: finished Download: %s - %s", id, y.Url())
+
+	audio := provider.AudioFile{Ext: ext, Subtitles: findSubtitles(work, id, SubtitleLangs)}
+	if len(opts.RemoveCategories) > 0 {
+		audio.Cut = y.removeSegments(file, opts)
+	}
+	err = os.Rename(file, filepath.Join(path, filepath.Base(file)))
+	if err != nil {
+		return provider.AudioFile{}, fmt.Errorf("%w: %v", ErrYoutube, err)
+	}
+	return audio, nil
+}
+
+// Stream implements provider.Streamer
+func (y *yt) Stream(ctx context.Context) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, "yt-dlp", "--quiet", "--format", "bestaudio", "-o", "-", y.Url())
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrYoutube, err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	log.Printf("⏳ yt: running cmd:  %s\n", cmd)
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed cmd %s: %v", ErrYoutube, cmd, err)
+	}
+	return &cmdReader{ReadCloser: out, cmd: cmd, stderr: &stderr}, nil
+}
+
+// Finish implements provider.Streamer. The file is cut before it is moved,
+// the subtitles are left next to it.
+func (y *yt) Finish(id uuid.UUID, file string, path string, opts provider.AudioOptions) (provider.AudioFile, error) {
+	audio := provider.AudioFile{
+		Ext:       strings.TrimPrefix(filepath.Ext(file), "."),
+		Subtitles: y.downloadSubtitles(id, filepath.Dir(file)),
+	}
+	if len(opts.RemoveCategories) > 0 {
+		audio.Cut = y.removeSegments(file, opts)
+	}
+	err := os.Rename(file, filepath.Join(path, filepath.Base(file)))
+	if err != nil {
+		return provider.AudioFile{}, fmt.Errorf("%w: %v", ErrYoutube, err)
+	}
+	return audio, nil
+}
+
+// downloadSubtitles writes only the subtitles of the video to path. The
+// audio is usable without them, so failures are only logged.
+func (y *yt) downloadSubtitles(id uuid.UUID, path string) []provider.Subtitle {
+	if len(SubtitleLangs) == 0 {
+		return nil
+	}
+	args := []string{"--quiet", "--skip-download", "-P", path, "-o", id.String() + ".%(ext)s"}
+	args = append(args, subtitleArgs(SubtitleLangs)...)
+	cmd := exec.Command("yt-dlp", append(args, y.Url())...)
+	log.Printf("⏳ yt: running cmd:  %s\n", cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("yt: no subtitles for %s: %v: %s", y.ytid, err, out)
+		return nil
+	}
+	return findSubtitles(path, id, SubtitleLangs)
+}
+
+// cmdReader reads the output of a command, Close waits for it to exit
+type cmdReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (r *cmdReader) Close() error {
+	// yt-dlp stops on the closed pipe if the output was not read to the end
+	_ = r.ReadCloser.Close()
+	err := r.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("%w: failed cmd %s: %v: %s", ErrYoutube, r.cmd, err, r.stderr.Bytes())
+	}
 	return nil
 }
 
+// removeSegments cuts the SponsorBlock segments of the video from the
+// audio file and returns the removed segments. The uncut audio is still
+// usable, so failures are only logged.
+func (y *yt) removeSegments(file string, opts provider.AudioOptions) []provider.Segment {
+	segments, err := sponsorSegments(y.ytid, opts.RemoveCategories)
+	if err != nil {
+		log.Printf("yt: keeping segments of %s: %v", y.ytid, err)
+		return nil
+	}
+	err = media.Cut(file, segments, opts.Bitrate, opts.SampleRate)
+	if err != nil {
+		log.Printf("yt: keeping segments of %s: %v", y.ytid, err)
+		return nil
+	}
+	if len(segments) > 0 {
+		log.Printf("✅ yt: removed %d sponsorblock segments from %s", len(segments), y.ytid)
+	}
+	return segments
+}
+
+// audioArgs returns the yt-dlp arguments selecting the audio profile.
+// The original format is only remuxed, so bitrate and channels are ignored.
+func audioArgs(opts provider.AudioOptions) []string {
+	if opts.Format == provider.FormatOriginal {
+		return []string{"--format", "bestaudio", "--extract-audio"}
+	}
+	format := opts.Format
+	if format == "" {
+		format = provider.FormatMP3
+	}
+	args := []string{"--extract-audio", "--audio-format", string(format)}
+	if opts.Bitrate > 0 {
+		args = append(args, "--audio-quality", fmt.Sprintf("%dK", opts.Bitrate))
+	}
+	var ffmpeg []string
+	if opts.Channels > 0 {
+		ffmpeg = append(ffmpeg, "-ac", strconv.Itoa(opts.Channels))
+	}
+	if opts.SampleRate > 0 {
+		ffmpeg = append(ffmpeg, "-ar", strconv.Itoa(opts.SampleRate))
+	}
+	if len(ffmpeg) > 0 {
+		args = append(args, "--postprocessor-args", "ExtractAudio:"+strings.Join(ffmpeg, " "))
+	}
+	return args
+}
+
+// subtitleArgs returns the yt-dlp arguments writing subtitles as WebVTT.
+// Missing subtitles are no error for yt-dlp.
+func subtitleArgs(langs []string) []string {
+	if len(langs) == 0 {
+		return nil
+	}
+	return []string{
+		"--write-subs", "--write-auto-subs",
+		"--sub-langs", strings.Join(langs, ","),
+		"--sub-format", "vtt/best",
+		"--convert-subs", "vtt",
+	}
+}
+
+// findSubtitles returns the subtitle files yt-dlp wrote for id, which are
+// named <id>.<lang>.vtt
+func findSubtitles(path string, id uuid.UUID, langs []string) []provider.Subtitle {
+	var subtitles []provider.Subtitle
+	for _, lang := range langs {
+		file := filepath.Join(path, fmt.Sprintf("%s.%s.vtt", id, lang))
+		if _, err := os.Stat(file); err == nil {
+			subtitles = append(subtitles, provider.Subtitle{Lang: lang, Path: file})
+		}
+	}
+	return subtitles
+}
+
+// ytMeta is the part of the yt-dlp --dump-json output tubefeed keeps
+type ytMeta struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Uploader    string   `json:"uploader"`
+	Duration    float64  `json:"duration"`
+	Description string   `json:"description"`
+	Thumbnail   string   `json:"thumbnail"`
+	UploadDate  string   `json:"upload_date"`
+	Tags        []string `json:"tags"`
+	Categories  []string `json:"categories"`
+	ViewCount   int64    `json:"view_count"`
+	Chapters    []struct {
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+		Title     string  `json:"title"`
+	} `json:"chapters"`
+}
+
 // Refreshes YouTube video metadata
 func (y *yt) LoadMetadata() (*provider.VideoMeta, error) {
-	var err error
-
 	cmd := exec.Command("yt-dlp", "--quiet", "--skip-download", "--dump-json", y.Url())
 	log.Printf("⏳ running cmd:  %s\n", cmd)
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed cmd %s: %v: %s", ErrYoutube, cmd, err, out)
 	}
-	var result map[string]any
-	err = json.Unmarshal([]byte(out), &result)
+	meta, err := parseMetadata(out)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrYoutube, err)
+		return nil, err
 	}
-
-	if result["id"] != y.ytid {
+	if meta.ProviderID != y.ytid {
 		return nil, fmt.Errorf("%w: video id from result didnt match", ErrYoutube)
 	}
-	meta := provider.VideoMeta{
-		Title:   result["title"].(string),
-		Channel: result["uploader"].(string),
-		Length:  time.Duration(int(result["duration"].(float64))) * time.Second,
-		URL:     y.Url(),
+	meta.URL = y.Url()
+	return meta, nil
+}
+
+// parseMetadata converts the json printed by yt-dlp --dump-json
+func parseMetadata(out []byte) (*provider.VideoMeta, error) {
+	var result ytMeta
+	err := json.Unmarshal(out, &result)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrYoutube, err)
 	}
 
+	meta := provider.VideoMeta{
+		ProviderID:  result.ID,
+		Title:       result.Title,
+		Channel:     result.Uploader,
+		Length:      time.Duration(result.Duration) * time.Second,
+		Description: result.Description,
+		URL:         url(result.ID),
+		Thumbnail:   result.Thumbnail,
+		Tags:        result.Tags,
+		Categories:  result.Categories,
+		ViewCount:   result.ViewCount,
+	}
+	if result.UploadDate != "" {
+		meta.UploadDate, err = time.Parse("20060102", result.UploadDate)
+		if err != nil {
+			log.Printf("yt: ignoring upload date %q: %v", result.UploadDate, err)
+		}
+	}
+	for _, ch := range result.Chapters {
+		meta.Chapters = append(meta.Chapters, provider.Chapter{
+			Start: seconds(ch.StartTime),
+			End:   seconds(ch.EndTime),
+			Title: ch.Title,
+		})
+	}
 	return &meta, nil
 }
 
+// seconds converts fractional seconds as used by yt-dlp
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
 // Extracts video ID from the provided YouTube URL
 func extractVideoID(url string) (string, error) {
 	if strings.Contains(url, "v=") {
@@ -0,0 +1,88 @@
+package yt
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"tubefeed/internal/provider"
+)
+
+func TestParseMetadata(t *testing.T) {
+	out := []byte(`{
+		"id": "abc123",
+		"title": "A Title",
+		"uploader": "A Channel",
+		"duration": 125,
+		"description": "line one\nline two",
+		"thumbnail": "https://i.ytimg.com/vi/abc123/maxresdefault.jpg",
+		"upload_date": "20240131",
+		"tags": ["go", "sqlite"],
+		"categories": ["Education"],
+		"view_count": 4711,
+		"chapters": [
+			{"start_time": 0, "end_time": 60.5, "title": "Intro"},
+			{"start_time": 60.5, "end_time": 125, "title": "Main"}
+		]
+	}`)
+	meta, err := parseMetadata(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.ProviderID != "abc123" || meta.Title != "A Title" || meta.Channel != "A Channel" {
+		t.Errorf("unexpected identity: %+v", meta)
+	}
+	if meta.Length != 125*time.Second {
+		t.Errorf("Length = %v", meta.Length)
+	}
+	if want := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC); !meta.UploadDate.Equal(want) {
+		t.Errorf("UploadDate = %v, want %v", meta.UploadDate, want)
+	}
+	if len(meta.Tags) != 2 || meta.Tags[1] != "sqlite" || len(meta.Categories) != 1 {
+		t.Errorf("Tags = %v, Categories = %v", meta.Tags, meta.Categories)
+	}
+	if meta.ViewCount != 4711 {
+		t.Errorf("ViewCount = %d", meta.ViewCount)
+	}
+	if len(meta.Chapters) != 2 || meta.Chapters[1].Start != 60500*time.Millisecond || meta.Chapters[1].Title != "Main" {
+		t.Errorf("Chapters = %+v", meta.Chapters)
+	}
+}
+
+func TestParseMetadataMissingFields(t *testing.T) {
+	meta, err := parseMetadata([]byte(`{"id": "abc123"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.UploadDate.IsZero() || meta.Chapters != nil {
+		t.Errorf("unexpected defaults: %+v", meta)
+	}
+}
+
+func TestAudioArgs(t *testing.T) {
+	cases := []struct {
+		opts provider.AudioOptions
+		want string
+	}{
+		{provider.AudioOptions{}, "--extract-audio --audio-format mp3"},
+		{provider.AudioOptions{Format: provider.FormatOriginal, Bitrate: 64}, "--format bestaudio --extract-audio"},
+		{
+			provider.AudioOptions{Format: provider.FormatOpus, Bitrate: 48, Channels: 1, SampleRate: 24000},
+			"--extract-audio --audio-format opus --audio-quality 48K --postprocessor-args ExtractAudio:-ac 1 -ar 24000",
+		},
+	}
+	for _, c := range cases {
+		if got := strings.Join(audioArgs(c.opts), " "); got != c.want {
+			t.Errorf("audioArgs(%+v) = %q, want %q", c.opts, got, c.want)
+		}
+	}
+}
+
+func TestSubtitleArgs(t *testing.T) {
+	if args := subtitleArgs(nil); args != nil {
+		t.Errorf("subtitleArgs(nil) = %q, want none", args)
+	}
+	want := "--write-subs --write-auto-subs --sub-langs en,de --sub-format vtt/best --convert-subs vtt"
+	if got := strings.Join(subtitleArgs([]string{"en", "de"}), " "); got != want {
+		t.Errorf("subtitleArgs() = %q, want %q", got, want)
+	}
+}
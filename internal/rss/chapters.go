@@ -0,0 +1,35 @@
+package rss
+
+import (
+	"tubefeed/internal/meta"
+)
+
+// ChaptersType is the mime type of Podcasting 2.0 JSON chapters
+const ChaptersType = "application/json+chapters"
+
+// PodcastChapters is a Podcasting 2.0 JSON chapters file
+// https://github.com/Podcastindex-org/podcast-namespace/blob/main/chapters/jsonChapters.md
+type PodcastChapters struct {
+	Version  string           `json:"version"`
+	Chapters []PodcastChapter `json:"chapters"`
+}
+
+// PodcastChapter is a chapter, times are in seconds of the audio file
+type PodcastChapter struct {
+	StartTime float64 `json:"startTime"`
+	EndTime   float64 `json:"endTime,omitempty"`
+	Title     string  `json:"title"`
+}
+
+// GenerateChapters returns the chapters of video matched to its audio file
+func GenerateChapters(video meta.Video) PodcastChapters {
+	chapters := PodcastChapters{Version: "1.2.0", Chapters: []PodcastChapter{}}
+	for _, ch := range video.Meta.Chapters {
+		chapters.Chapters = append(chapters.Chapters, PodcastChapter{
+			StartTime: video.AudioTime(ch.Start).Seconds(),
+			EndTime:   video.AudioTime(ch.End).Seconds(),
+			Title:     ch.Title,
+		})
+	}
+	return chapters
+}
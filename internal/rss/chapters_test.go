@@ -0,0 +1,45 @@
+package rss
+
+import (
+	"testing"
+	"time"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+)
+
+func TestGenerateChapters(t *testing.T) {
+	chapters := []provider.Chapter{
+		{Start: 0, End: time.Minute, Title: "Intro"},
+		{Start: time.Minute, End: 5 * time.Minute, Title: "Main"},
+		{Start: 5 * time.Minute, End: 6 * time.Minute, Title: "Outro"},
+	}
+	cut := []provider.Segment{{Start: 30 * time.Second, End: 90 * time.Second, Category: "sponsor"}}
+	cases := []struct {
+		name  string
+		video meta.Video
+		want  [][2]float64
+	}{
+		{"unchanged", meta.Video{}, [][2]float64{{0, 60}, {60, 300}, {300, 360}}},
+		{"cut", meta.Video{Cut: cut}, [][2]float64{{0, 30}, {30, 240}, {240, 300}}},
+		{"trimmed", meta.Video{Trimmed: 10 * time.Second}, [][2]float64{{0, 50}, {50, 290}, {290, 350}}},
+		{"tempo", meta.Video{Tempo: 2}, [][2]float64{{0, 30}, {30, 150}, {150, 180}}},
+		{"all", meta.Video{Cut: cut, Trimmed: 10 * time.Second, Tempo: 2}, [][2]float64{{0, 10}, {10, 115}, {115, 145}}},
+	}
+	for _, tc := range cases {
+		tc.video.Meta.Chapters = chapters
+		got := GenerateChapters(tc.video)
+		if got.Version != "1.2.0" || len(got.Chapters) != len(tc.want) {
+			t.Fatalf("%s: chapters = %+v", tc.name, got)
+		}
+		for i, ch := range got.Chapters {
+			if ch.StartTime != tc.want[i][0] || ch.EndTime != tc.want[i][1] || ch.Title != chapters[i].Title {
+				t.Errorf("%s: chapter %d = %+v, want %v", tc.name, i, ch, tc.want[i])
+			}
+		}
+	}
+
+	// videos without chapters encode an empty list instead of null
+	if got := GenerateChapters(meta.Video{}); got.Chapters == nil || len(got.Chapters) != 0 {
+		t.Errorf("chapters without chapters = %+v", got.Chapters)
+	}
+}
@@ -1,23 +1,31 @@
 package rss
 
 import (
+	"cmp"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
+	"tubefeed/internal/media"
 	"tubefeed/internal/meta"
+	"tubefeed/internal/transcript"
+
+	"github.com/google/uuid"
 )
 
 var ErrRSS = errors.New("rss error")
 
-const rfc2822 = "Mon Jan 02 2006 15:04:05 MST"
+const rfc2822 = time.RFC1123Z
 
 // PodcastRSS defines the structure for the podcast RSS XML feed
 type PodcastRSS struct {
-	XMLName     xml.Name       `xml:"rss"`
-	Version     string         `xml:"version,attr"`
-	XmlnsItunes string         `xml:"xmlns:itunes,attr"`
-	Channel     PodcastChannel `xml:"channel"`
+	XMLName      xml.Name       `xml:"rss"`
+	Version      string         `xml:"version,attr"`
+	XmlnsItunes  string         `xml:"xmlns:itunes,attr"`
+	XmlnsPodcast string         `xml:"xmlns:podcast,attr"`
+	Channel      PodcastChannel `xml:"channel"`
 }
 
 // PodcastChannel is the rss feed
@@ -27,6 +35,7 @@ type PodcastChannel struct {
 	Description string        `xml:"description"`
 	Language    string        `xml:"language"`
 	Author      string        `xml:"itunes:author"`
+	Type        string        `xml:"itunes:type"`
 	Image       PodcastImage  `xml:"itunes:image"`
 	Items       []PodcastItem `xml:"item"`
 }
@@ -38,12 +47,32 @@ type PodcastImage struct {
 
 // PodcastItem is an Item
 type PodcastItem struct {
-	Title       string           `xml:"title"`
-	Description string           `xml:"description"`
-	PubDate     string           `xml:"pubDate"`
-	Link        string           `xml:"link"`
-	GUID        string           `xml:"guid"`
-	Enclosure   PodcastEnclosure `xml:"enclosure"`
+	Title       string              `xml:"title"`
+	Description string              `xml:"description"`
+	PubDate     string              `xml:"pubDate"`
+	Link        string              `xml:"link"`
+	GUID        string              `xml:"guid"`
+	Duration    int                 `xml:"itunes:duration,omitempty"` // seconds
+	Keywords    string              `xml:"itunes:keywords,omitempty"`
+	Image       *PodcastImage       `xml:"itunes:image"`
+	Episode     int                 `xml:"itunes:episode,omitempty"`
+	Chapters    *PodcastLink        `xml:"podcast:chapters"`
+	Transcripts []PodcastTranscript `xml:"podcast:transcript"`
+	Enclosure   PodcastEnclosure    `xml:"enclosure"`
+}
+
+// PodcastTranscript links a transcript of an episode
+type PodcastTranscript struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr,omitempty"`
+	Rel      string `xml:"rel,attr,omitempty"`
+}
+
+// PodcastLink references a file of the Podcasting 2.0 namespace
+type PodcastLink struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
 }
 
 // PodcastEnclosure is enclosure
@@ -63,45 +92,122 @@ func NewRSS(externalUrl string) *RSS {
 	}
 }
 
-// Generates a podcast RSS feed with the given metadata
-func (r *RSS) GeneratePodcastFeed(videos []meta.Video, tabname string) (string, error) {
+// Generates a podcast RSS feed with the given metadata. Items keep the
+// order of videos, serial tabs number their episodes in manual order or,
+// for the other sort modes, in the order they were added.
+func (r *RSS) GeneratePodcastFeed(videos []meta.Video, tab meta.Tab) (string, error) {
+	tabname := tab.Name
 	channel := PodcastChannel{
 		Title:       fmt.Sprintf("%s - Tubefeed", tabname),
 		Link:        r.ExternalUrl,
 		Description: "A collection of videos as podcast episodes.",
 		Language:    "en-us",
 		Author:      "Tubefeed",
+		Type:        "episodic",
 		Image:       PodcastImage{Href: fmt.Sprintf("http://%s/static/logo.png", r.ExternalUrl)},
 	}
+	if tab.Serial {
+		channel.Type = "serial"
+	}
 
+	// videos split into chapter episodes are published as their chapters
+	split := make(map[uuid.UUID]bool)
 	for _, video := range videos {
-		if video.Status != meta.StatusReady {
-			continue
+		if video.IsChapter() {
+			split[video.ParentID] = true
+		}
+	}
+
+	var listed []meta.Video
+	for _, video := range videos {
+		// on demand audio is downloaded when the podcast app requests it
+		ok := video.Status == meta.StatusReady || video.Status == meta.StatusOnDemand
+		if ok && !split[video.ID] {
+			listed = append(listed, video)
+		}
+	}
+	episodes := episodeNumbers(listed, tab.Sort)
+
+	for _, video := range listed {
+		pubDate := video.Added
+		if pubDate.IsZero() {
+			pubDate = time.Now()
 		}
 		audioURL := fmt.Sprintf("http://%s/audio/%s", r.ExternalUrl, video.ID)
 
+		description := video.Meta.Description
+		if description == "" {
+			description = fmt.Sprintf("created with Tubefeed on playlist %s", tabname)
+		}
+
 		// https://help.apple.com/itc/podcasts_connect/#/itcb54353390
 		item := PodcastItem{
 			Title:       fmt.Sprintf("%s - %s", video.Meta.Channel, video.Meta.Title),
-			Description: fmt.Sprintf("created with Tubefeed on playlist %s", tabname),
-			PubDate:     time.Now().Format(rfc2822),
+			Description: description,
+			PubDate:     pubDate.Format(rfc2822),
 			Link:        video.Meta.URL,
 			GUID:        video.ID.String(),
+			Duration:    int(video.AudioTime(video.Meta.Length).Seconds()),
+			Keywords:    strings.Join(video.Meta.Tags, ","),
 			Enclosure: PodcastEnclosure{
 				URL:    audioURL,
-				Length: fmt.Sprintf("%d", 0), // TODO: size in bytes of the audio file
-				Type:   "audio/mpeg",
+				Length: fmt.Sprintf("%d", video.Size), // 0 until the audio is downloaded
+				Type:   media.ContentType(video.Ext),
 			},
 		}
+		if video.Meta.Thumbnail != "" {
+			item.Image = &PodcastImage{Href: fmt.Sprintf("http://%s/image/%s", r.ExternalUrl, video.ID)}
+		}
+		if len(video.Meta.Chapters) > 0 {
+			item.Chapters = &PodcastLink{
+				URL:  fmt.Sprintf("http://%s/chapters/%s.json", r.ExternalUrl, video.ID),
+				Type: ChaptersType,
+			}
+		}
+		if video.TranscriptLang != "" {
+			for _, ext := range []string{"vtt", "srt"} {
+				item.Transcripts = append(item.Transcripts, PodcastTranscript{
+					URL:      fmt.Sprintf("http://%s/transcript/%s.%s", r.ExternalUrl, video.ID, ext),
+					Type:     transcript.ContentType(ext),
+					Language: video.TranscriptLang,
+					Rel:      "captions",
+				})
+			}
+		}
+		if tab.Serial {
+			item.Episode = episodes[video.ID]
+		}
 		channel.Items = append(channel.Items, item)
 	}
 
 	rss := PodcastRSS{
-		Version:     "2.0",
-		XmlnsItunes: "http://www.itunes.com/dtds/podcast-1.0.dtd",
-		Channel:     channel,
+		Version:      "2.0",
+		XmlnsItunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		XmlnsPodcast: "https://podcastindex.org/namespace/1.0",
+		Channel:      channel,
 	}
 
 	output, _ := xml.MarshalIndent(rss, "", "  ")
 	return xml.Header + string(output), nil
 }
+
+// episodeNumbers numbers videos from 1 in manual order, or by the time they
+// were added if the tab is sorted otherwise, so numbers do not change with
+// the display order or when newer videos are added.
+func episodeNumbers(videos []meta.Video, mode meta.SortMode) map[uuid.UUID]int {
+	ordered := slices.Clone(videos)
+	if mode == meta.SortManual {
+		slices.SortStableFunc(ordered, func(a, b meta.Video) int {
+			return cmp.Compare(a.Position, b.Position)
+		})
+	} else {
+		slices.SortStableFunc(ordered, func(a, b meta.Video) int {
+			return a.Added.Compare(b.Added)
+		})
+	}
+	numbers := make(map[uuid.UUID]int, len(ordered))
+	for i, video := range ordered {
+		numbers[video.ID] = i + 1
+	}
+	return numbers
+}
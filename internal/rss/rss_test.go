@@ -0,0 +1,77 @@
+package rss
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"tubefeed/internal/meta"
+	"tubefeed/internal/provider"
+
+	"github.com/google/uuid"
+)
+
+func TestEpisodeNumbers(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	videos := []meta.Video{
+		{ID: uuid.New(), Position: 2, Added: now},
+		{ID: uuid.New(), Position: 0, Added: now.Add(-time.Hour)},
+		{ID: uuid.New(), Position: 1, Added: now.Add(-2 * time.Hour)},
+	}
+	cases := []struct {
+		mode meta.SortMode
+		want []int
+	}{
+		{meta.SortManual, []int{3, 1, 2}},
+		{meta.SortAdded, []int{3, 2, 1}},
+		{meta.SortTitle, []int{3, 2, 1}},
+	}
+	for _, tc := range cases {
+		numbers := episodeNumbers(videos, tc.mode)
+		for i, video := range videos {
+			if numbers[video.ID] != tc.want[i] {
+				t.Errorf("%s: episode of video %d = %d, want %d", tc.mode, i, numbers[video.ID], tc.want[i])
+			}
+		}
+	}
+}
+
+func TestFeedChapters(t *testing.T) {
+	with := meta.Video{
+		ID:     uuid.New(),
+		Ext:    "mp3",
+		Status: meta.StatusReady,
+		Meta:   provider.VideoMeta{Title: "With", Chapters: []provider.Chapter{{End: time.Minute, Title: "Intro"}}},
+	}
+	without := meta.Video{ID: uuid.New(), Ext: "mp3", Status: meta.StatusReady, Meta: provider.VideoMeta{Title: "Without"}}
+	feed, err := NewRSS("example.com").GeneratePodcastFeed([]meta.Video{with, without}, meta.Tab{Name: "Tab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := fmt.Sprintf(`<podcast:chapters url="http://example.com/chapters/%s.json" type="%s"></podcast:chapters>`, with.ID, ChaptersType)
+	if !strings.Contains(feed, link) {
+		t.Errorf("feed is missing %s:\n%s", link, feed)
+	}
+	if n := strings.Count(feed, "<podcast:chapters"); n != 1 {
+		t.Errorf("feed has %d chapter links, want 1", n)
+	}
+}
+
+func TestFeedEnclosureLength(t *testing.T) {
+	videos := []meta.Video{
+		{ID: uuid.New(), Ext: "mp3", Status: meta.StatusReady, Size: 12345},
+		{ID: uuid.New(), Ext: "mp3", Status: meta.StatusOnDemand},
+	}
+	feed, err := NewRSS("example.com").GeneratePodcastFeed(videos, meta.Tab{Name: "Tab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf(`<enclosure url="http://example.com/audio/%s" length="12345" type="audio/mpeg">`, videos[0].ID),
+		fmt.Sprintf(`<enclosure url="http://example.com/audio/%s" length="0" type="audio/mpeg">`, videos[1].ID),
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed is missing %s:\n%s", want, feed)
+		}
+	}
+}
@@ -1,21 +1,57 @@
 -- name: SaveMetadata :exec
-INSERT OR REPLACE INTO videos (
-  uuid, title, channel, status, length, url, tabid
+INSERT INTO videos (
+  uuid, title, channel, status, length, url, tabid, upload_date, added_at, position,
+  description, provider_id, thumbnail, tags, categories, view_count, split_chapters, parent_id
 ) VALUES (
-  ?, ?, ?, ?, ?, ?, ?
-);
+  ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+ON CONFLICT(uuid) DO UPDATE SET
+  title = excluded.title,
+  channel = excluded.channel,
+  status = excluded.status,
+  length = excluded.length,
+  url = excluded.url,
+  upload_date = excluded.upload_date,
+  description = excluded.description,
+  provider_id = excluded.provider_id,
+  thumbnail = excluded.thumbnail,
+  tags = excluded.tags,
+  categories = excluded.categories,
+  view_count = excluded.view_count;
 
 -- name: LoadDatabase :many
-SELECT uuid, title, channel, status, length, url
+SELECT *
 FROM videos
-WHERE tabid = ?;
+WHERE tabid = ?
+ORDER BY position, added_at;
+
+-- name: SearchVideos :many
+SELECT *
+FROM videos
+WHERE rowid IN (
+  SELECT rowid
+  FROM videos_fts
+  WHERE videos_fts MATCH sqlc.arg(query)
+)
+ORDER BY added_at DESC;
+
+-- name: AllVideos :many
+SELECT *
+FROM videos
+ORDER BY added_at DESC;
 
 -- name: GetVideo :one
-SELECT title, channel, status, length, url
+SELECT *
 FROM videos
 WHERE uuid = ?
 LIMIT 1;
 
+-- name: GetChildren :many
+SELECT *
+FROM videos
+WHERE parent_id = ?
+ORDER BY position;
+
 -- name: DeleteVideo :exec
 DELETE FROM videos
 WHERE uuid = ?;
@@ -24,6 +60,41 @@ WHERE uuid = ?;
 DELETE FROM videos
 WHERE tabid = ?;
 
+-- name: MoveVideo :exec
+UPDATE videos
+SET tabid = ?, position = ?
+WHERE uuid = ?;
+
+-- name: CopyVideo :exec
+INSERT INTO videos (
+  uuid, title, channel, length, size, url, status, provider_id, tabid, audio_id,
+  position, added_at, upload_date, description, thumbnail, tags, categories, view_count,
+  audio_ext, processing, tempo, cut_segments, transcript, transcript_lang, trimmed_ms
+)
+SELECT
+  CAST(sqlc.arg(new_uuid) AS TEXT), title, channel, length, size, url, status, provider_id,
+  CAST(sqlc.arg(tabid) AS INTEGER), coalesce(audio_id, uuid),
+  CAST(sqlc.arg(position) AS INTEGER), CAST(sqlc.arg(added_at) AS INTEGER), upload_date,
+  description, thumbnail, tags, categories, view_count, audio_ext, processing, tempo,
+  cut_segments, transcript, transcript_lang, trimmed_ms
+FROM videos
+WHERE uuid = sqlc.arg(uuid);
+
+-- name: NextPosition :one
+SELECT CAST(coalesce(max(position), 0) + 1 AS INTEGER) AS position
+FROM videos
+WHERE tabid = ?;
+
+-- name: SetPosition :exec
+UPDATE videos
+SET position = ?
+WHERE uuid = ? AND tabid = ?;
+
+-- name: CountAudioReferences :one
+SELECT count(*)
+FROM videos
+WHERE uuid = ? OR audio_id = ?;
+
 -- name: CountDuplicate :one
 SELECT count(*)
 FROM videos
@@ -35,15 +106,141 @@ UPDATE videos
 SET status = ?
 WHERE uuid = ?;
 
+-- name: SetAudioFile :exec
+UPDATE videos
+SET audio_ext = sqlc.arg(audio_ext), cut_segments = sqlc.arg(cut_segments)
+WHERE coalesce(audio_id, uuid) = CAST(sqlc.arg(audio_id) AS TEXT);
+
+-- name: SetProcessing :exec
+UPDATE videos
+SET processing = sqlc.arg(processing), tempo = sqlc.arg(tempo), trimmed_ms = sqlc.arg(trimmed_ms)
+WHERE coalesce(audio_id, uuid) = CAST(sqlc.arg(audio_id) AS TEXT);
+
+-- name: SetTranscript :exec
+UPDATE videos
+SET transcript = sqlc.arg(transcript), transcript_lang = sqlc.arg(transcript_lang)
+WHERE coalesce(audio_id, uuid) = CAST(sqlc.arg(audio_id) AS TEXT);
+
+-- name: TouchAudio :exec
+UPDATE videos
+SET accessed_at = sqlc.arg(accessed_at)
+WHERE coalesce(audio_id, uuid) = CAST(sqlc.arg(audio_id) AS TEXT);
+
+-- name: SetAudioStatus :exec
+UPDATE videos
+SET status = sqlc.arg(status)
+WHERE coalesce(audio_id, uuid) = CAST(sqlc.arg(audio_id) AS TEXT);
+
+-- name: SetAudioSize :exec
+UPDATE videos
+SET size = sqlc.arg(size)
+WHERE coalesce(audio_id, uuid) = CAST(sqlc.arg(audio_id) AS TEXT);
+
+-- name: GetTabUsage :many
+-- bytes of the audio files of each tab, copies within a tab count once
+SELECT CAST(tabid AS INTEGER) AS tabid, count(*) AS files, CAST(coalesce(sum(size), 0) AS INTEGER) AS bytes
+FROM (
+  SELECT tabid, max(coalesce(size, 0)) AS size
+  FROM videos
+  GROUP BY tabid, coalesce(audio_id, uuid)
+)
+GROUP BY tabid;
+
+-- name: GetTotalUsage :one
+SELECT CAST(coalesce(sum(size), 0) AS INTEGER) AS bytes
+FROM (
+  SELECT max(coalesce(size, 0)) AS size
+  FROM videos
+  GROUP BY coalesce(audio_id, uuid)
+);
+
+-- name: GetIdleAudio :many
+-- downloaded audio files only used in lazy tabs, requested but not since before
+SELECT CAST(coalesce(audio_id, uuid) AS TEXT) AS audio_id, max(audio_ext) AS audio_ext
+FROM videos
+WHERE status = 'Available'
+GROUP BY coalesce(audio_id, uuid)
+HAVING max(accessed_at) > 0 AND max(accessed_at) < sqlc.arg(before)
+  AND min(tabid IN (SELECT id FROM tabs WHERE lazy)) = 1;
+
+-- name: SetPlayed :exec
+UPDATE videos
+SET played = ?
+WHERE uuid = ?;
+
 -- name: GetStatus :exec
 SELECT status
 FROM videos
 WHERE uuid = ?;
 
+-- name: GetChapters :many
+SELECT *
+FROM chapters
+WHERE audio_id = ?
+ORDER BY start_ms;
+
+-- name: GetTabChapters :many
+SELECT chapters.*
+FROM chapters
+JOIN videos ON chapters.audio_id = coalesce(videos.audio_id, videos.uuid)
+WHERE videos.tabid = ?
+ORDER BY chapters.audio_id, chapters.start_ms;
+
+-- name: AddChapter :exec
+INSERT INTO chapters (
+  audio_id, start_ms, end_ms, title
+) VALUES (
+  ?, ?, ?, ?
+);
+
+-- name: DeleteChapters :exec
+DELETE FROM chapters
+WHERE audio_id = ?;
+
 -- name: LoadTabs :many
 SELECT *
 FROM tabs;
 
+-- name: GetTab :one
+SELECT *
+FROM tabs
+WHERE id = ?;
+
+-- name: SetTabSort :exec
+UPDATE tabs
+SET sort = ?, serial = ?
+WHERE id = ?;
+
+-- name: SetTabAudio :exec
+UPDATE tabs
+SET audio_format = ?, audio_bitrate = ?, audio_channels = ?, audio_samplerate = ?
+WHERE id = ?;
+
+-- name: SetTabProcess :exec
+UPDATE tabs
+SET loudnorm = ?, trim_silence = ?, speed = ?
+WHERE id = ?;
+
+-- name: SetTabSponsorBlock :exec
+UPDATE tabs
+SET sponsorblock = ?
+WHERE id = ?;
+
+-- name: SetTabLazy :exec
+UPDATE tabs
+SET lazy = ?
+WHERE id = ?;
+
+-- name: SetTabRetention :exec
+UPDATE tabs
+SET keep_last = ?, keep_days = ?, keep_unplayed = ?, max_size = ?
+WHERE id = ?;
+
+-- name: SetTabQuota :exec
+UPDATE tabs
+SET quota = ?
+WHERE id = ?;
+
 -- name: ChangeTabName :exec
 UPDATE tabs
 SET name = ?
@@ -5,3 +5,8 @@ import _ "embed"
 
 //go:embed schema.sql
 var Schema string
+
+// SearchSchema needs the sqlite fts5 extension (build tag sqlite_fts5)
+//
+//go:embed search.sql
+var SearchSchema string
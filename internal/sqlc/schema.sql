@@ -8,10 +8,54 @@
   status          TEXT NOT NULL,
   provider_id     TEXT,
   tabid           INTEGER,
+  audio_id        TEXT,  -- uuid of the shared audio file for copies, NULL if uuid
+  position        INTEGER NOT NULL DEFAULT 0,  -- manual order within the tab
+  added_at        INTEGER NOT NULL DEFAULT 0,  -- unix time the video was added to the tab
+  upload_date     INTEGER,  -- unix time the video was published
+  played          BOOLEAN NOT NULL DEFAULT 0,
+  description     TEXT NOT NULL DEFAULT '',
+  thumbnail       TEXT NOT NULL DEFAULT '',  -- url of the thumbnail at the provider
+  tags            TEXT NOT NULL DEFAULT '[]',  -- json array
+  categories      TEXT NOT NULL DEFAULT '[]',  -- json array
+  view_count      INTEGER NOT NULL DEFAULT 0,
+  audio_ext       TEXT NOT NULL DEFAULT 'mp3',  -- extension of the audio file
+  processing      TEXT NOT NULL DEFAULT '[]',  -- json outcomes of the post-processing steps
+  tempo           REAL NOT NULL DEFAULT 1,  -- speed of the audio file relative to the video
+  cut_segments    TEXT NOT NULL DEFAULT '[]',  -- json segments of the video removed from the audio
+  split_chapters  BOOLEAN NOT NULL DEFAULT 0,  -- create a child episode per chapter
+  parent_id       TEXT,  -- uuid of the video a chapter episode was split from
+  transcript      TEXT NOT NULL DEFAULT '',  -- plain text of the subtitles, for search
+  transcript_lang TEXT NOT NULL DEFAULT '',  -- language of the transcript files, empty if none
+  accessed_at     INTEGER NOT NULL DEFAULT 0,  -- unix time the audio was last requested
+  trimmed_ms      INTEGER NOT NULL DEFAULT 0,  -- silence trimmed from the start of the audio file
   FOREIGN KEY(tabid) REFERENCES tabs(id)
 );
 
+CREATE TABLE IF NOT EXISTS chapters (
+  audio_id  TEXT NOT NULL,  -- chapters belong to the audio file, shared by copies
+  start_ms  INTEGER NOT NULL,
+  end_ms    INTEGER NOT NULL,
+  title     TEXT NOT NULL,
+  PRIMARY KEY (audio_id, start_ms)
+);
+
 CREATE TABLE IF NOT EXISTS tabs (
   id    INTEGER PRIMARY KEY,
-  name  TEXT NOT NULL
+  name  TEXT NOT NULL,
+  sort  TEXT NOT NULL DEFAULT 'manual',  -- manual, added, uploaded, title, channel
+  serial BOOLEAN NOT NULL DEFAULT 0,  -- feed is published as itunes:type serial
+  audio_format     TEXT NOT NULL DEFAULT 'mp3',  -- mp3, m4a, opus, original
+  audio_bitrate    INTEGER NOT NULL DEFAULT 0,  -- kbit/s, 0 keeps the default
+  audio_channels   INTEGER NOT NULL DEFAULT 0,  -- 1 mono, 2 stereo, 0 as source
+  audio_samplerate INTEGER NOT NULL DEFAULT 0,  -- Hz, 0 as source
+  loudnorm         BOOLEAN NOT NULL DEFAULT 0,
+  trim_silence     BOOLEAN NOT NULL DEFAULT 0,
+  speed            REAL NOT NULL DEFAULT 1,
+  sponsorblock     TEXT NOT NULL DEFAULT '[]',  -- json list of SponsorBlock categories to remove
+  lazy             BOOLEAN NOT NULL DEFAULT 0,  -- audio is only downloaded when requested
+  keep_last        INTEGER NOT NULL DEFAULT 0,  -- retention: newest episodes kept, 0 keeps all
+  keep_days        INTEGER NOT NULL DEFAULT 0,  -- retention: days episodes are kept, 0 forever
+  keep_unplayed    BOOLEAN NOT NULL DEFAULT 0,  -- retention: unplayed episodes never expire
+  max_size         INTEGER NOT NULL DEFAULT 0,  -- retention: MB of audio kept, 0 unlimited
+  quota            INTEGER NOT NULL DEFAULT 0  -- MB of audio before new episodes are rejected, 0 unlimited
 );
@@ -0,0 +1,22 @@
+-- full text search index over videos, kept in sync by the triggers below
+CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(
+  title, channel, description, transcript,
+  content='videos', content_rowid='rowid'
+);
+
+CREATE TRIGGER IF NOT EXISTS videos_fts_insert AFTER INSERT ON videos BEGIN
+  INSERT INTO videos_fts(rowid, title, channel, description, transcript)
+  VALUES (new.rowid, new.title, new.channel, new.description, new.transcript);
+END;
+
+CREATE TRIGGER IF NOT EXISTS videos_fts_delete AFTER DELETE ON videos BEGIN
+  INSERT INTO videos_fts(videos_fts, rowid, title, channel, description, transcript)
+  VALUES ('delete', old.rowid, old.title, old.channel, old.description, old.transcript);
+END;
+
+CREATE TRIGGER IF NOT EXISTS videos_fts_update AFTER UPDATE OF title, channel, description, transcript ON videos BEGIN
+  INSERT INTO videos_fts(videos_fts, rowid, title, channel, description, transcript)
+  VALUES ('delete', old.rowid, old.title, old.channel, old.description, old.transcript);
+  INSERT INTO videos_fts(rowid, title, channel, description, transcript)
+  VALUES (new.rowid, new.title, new.channel, new.description, new.transcript);
+END;
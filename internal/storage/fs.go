@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FS keeps the files in a directory of the local disk
+type FS struct {
+	Dir string
+}
+
+func NewFS(dir string) *FS {
+	return &FS{Dir: dir}
+}
+
+func (s *FS) path(name string) string {
+	return filepath.Join(s.Dir, filepath.Base(name))
+}
+
+// Put writes to a temporary file first, readers never see a partial file
+func (s *FS) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	dst := s.path(name)
+	tmp := dst + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+type fsObject struct {
+	*os.File
+	info Info
+}
+
+func (o fsObject) Info() Info {
+	return o.info
+}
+
+func (s *FS) Open(ctx context.Context, name string) (Object, error) {
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return fsObject{File: f, info: fileInfo(info)}, nil
+}
+
+func (s *FS) Stat(ctx context.Context, name string) (Info, error) {
+	info, err := os.Stat(s.path(name))
+	if err != nil {
+		return Info{}, err
+	}
+	return fileInfo(info), nil
+}
+
+func (s *FS) Delete(ctx context.Context, name string) error {
+	err := os.Remove(s.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List skips directories like the cache of yt-dlp
+func (s *FS) List(ctx context.Context, prefix string) ([]Info, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []Info
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, fileInfo(info))
+	}
+	return files, nil
+}
+
+func fileInfo(info fs.FileInfo) Info {
+	return Info{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"tubefeed/internal/media"
+)
+
+// S3 keeps the files in a bucket of an S3 compatible object store like
+// AWS S3 or MinIO
+type S3 struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle puts the bucket in the path instead of the host name,
+	// MinIO needs it
+	PathStyle bool
+	Client    *http.Client
+}
+
+func (s *S3) signer() signer {
+	return signer{accessKey: s.AccessKey, secretKey: s.SecretKey, region: s.Region, service: "s3"}
+}
+
+func (s *S3) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// url returns the url of the object key, an empty key is the bucket
+func (s *S3) url(key string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: endpoint: %v", ErrStorage, err)
+	}
+	if s.PathStyle {
+		u.Path += "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	return u, nil
+}
+
+// do sends a signed request for key, responses other than 2xx are errors
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	u, err := s.url(key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStorage, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payload := emptyPayloadHash
+	if body != nil {
+		// a zero length would be sent chunked, which S3 refuses
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+		payload = unsignedPayload
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	s.signer().sign(req, payload, time.Now())
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %s: %v", ErrStorage, method, key, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("%w: %s %s: %s: %s", ErrStorage, method, key, resp.Status, msg)
+}
+
+// Put uploads r with an unsigned payload, the size has to be known
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	header := http.Header{}
+	header.Set("Content-Type", media.ContentType(strings.TrimPrefix(path.Ext(name), ".")))
+	resp, err := s.do(ctx, http.MethodPut, name, nil, io.NopCloser(r), size, header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) Stat(ctx context.Context, name string) (Info, error) {
+	resp, err := s.do(ctx, http.MethodHead, name, nil, nil, 0, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	resp.Body.Close()
+	info := Info{Name: name, Size: resp.ContentLength}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+func (s *S3) Open(ctx context.Context, name string) (Object, error) {
+	info, err := s.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{s3: s, ctx: ctx, info: info}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, name, nil, nil, 0, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// listResult is the response of ListObjectsV2
+type listResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]Info, error) {
+	var files []Info
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: list: %v", ErrStorage, err)
+		}
+		for _, c := range result.Contents {
+			files = append(files, Info{Name: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return files, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// PresignGet implements Presigner
+func (s *S3) PresignGet(name string, expires time.Duration, disposition string) (string, error) {
+	u, err := s.url(name)
+	if err != nil {
+		return "", err
+	}
+	if disposition != "" {
+		u.RawQuery = url.Values{"response-content-disposition": {disposition}}.Encode()
+	}
+	return s.signer().presign(http.MethodGet, u, expires, time.Now()), nil
+}
+
+// s3Object reads an object with range requests from the offset of the
+// last seek on
+type s3Object struct {
+	s3   *S3
+	ctx  context.Context
+	info Info
+	off  int64
+	body io.ReadCloser
+}
+
+func (o *s3Object) Info() Info {
+	return o.info
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.off >= o.info.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", o.off))
+		resp, err := o.s3.do(o.ctx, http.MethodGet, o.info.Name, nil, nil, 0, header)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent && o.off > 0 {
+			resp.Body.Close()
+			return 0, fmt.Errorf("%w: %s: range not supported", ErrStorage, o.info.Name)
+		}
+		o.body = resp.Body
+	}
+	n, err := o.body.Read(p)
+	o.off += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.off
+	case io.SeekEnd:
+		offset += o.info.Size
+	}
+	if offset < 0 {
+		return o.off, fmt.Errorf("%w: seek before start", ErrStorage)
+	}
+	if offset != o.off && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.off = offset
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
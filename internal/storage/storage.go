@@ -0,0 +1,116 @@
+// Package storage keeps the published audio files, on the local disk or
+// in an S3 compatible object store
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrStorage = errors.New("storage error")
+	// ErrNotExist is returned for missing files, it matches fs.ErrNotExist
+	ErrNotExist = fs.ErrNotExist
+)
+
+// Info describes a stored file
+type Info struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Object is an open stored file. Reads after a seek start at the new
+// offset, remote files are only requested when read.
+type Object interface {
+	io.ReadSeekCloser
+	Info() Info
+}
+
+// Storage keeps files by name, names are flat like the files of the
+// audio path
+type Storage interface {
+	// Put stores size bytes of r as name, replacing an existing file
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Open opens name for reading, ranges are read by seeking
+	Open(ctx context.Context, name string) (Object, error)
+	Stat(ctx context.Context, name string) (Info, error)
+	// Delete removes name, missing files are not an error
+	Delete(ctx context.Context, name string) error
+	// List returns the files whose names start with prefix
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// Presigner is implemented by storages which can hand out urls to read a
+// file without going through tubefeed
+type Presigner interface {
+	// PresignGet returns a url to GET name which is valid for expires.
+	// A non-empty disposition is sent as Content-Disposition.
+	PresignGet(name string, expires time.Duration, disposition string) (string, error)
+}
+
+// Local reports whether s keeps its files in dir, which makes publishing
+// and restoring the files of dir unnecessary
+func Local(s Storage, dir string) bool {
+	fs, ok := s.(*FS)
+	return ok && filepath.Clean(fs.Dir) == filepath.Clean(dir)
+}
+
+// Publish moves the file name of dir into s
+func Publish(ctx context.Context, s Storage, dir, name string) error {
+	if Local(s, dir) {
+		return nil
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	err = s.Put(ctx, name, f, info.Size())
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Restore copies the file name from s to dir unless it is there already,
+// restored reports whether it was copied and has to be published again
+func Restore(ctx context.Context, s Storage, dir, name string) (restored bool, err error) {
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil || Local(s, dir) {
+		return false, nil
+	}
+	obj, err := s.Open(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	defer obj.Close()
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(f, obj)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("%w: restore %s: %v", ErrStorage, name, err)
+	}
+	return true, nil
+}
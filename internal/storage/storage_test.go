@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-process S3 server for one bucket. It checks the
+// signatures of the requests and lists pageSize objects at a time.
+type fakeS3 struct {
+	t        *testing.T
+	signer   signer
+	bucket   string
+	pageSize int
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modified map[string]time.Time
+}
+
+func newFakeS3(t *testing.T) (*S3, *fakeS3) {
+	f := &fakeS3{
+		t:        t,
+		signer:   signer{accessKey: "key", secretKey: "secret", region: "us-east-1", service: "s3"},
+		bucket:   "audio",
+		pageSize: 2,
+		objects:  make(map[string][]byte),
+		modified: make(map[string]time.Time),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return &S3{
+		Endpoint:  srv.URL,
+		Region:    "us-east-1",
+		Bucket:    f.bucket,
+		AccessKey: "key",
+		SecretKey: "secret",
+		PathStyle: true,
+	}, f
+}
+
+// authorized recomputes the signature of r from its signed parts
+func (f *fakeS3) authorized(r *http.Request) bool {
+	q := r.URL.Query()
+	if sig := q.Get("X-Amz-Signature"); sig != "" {
+		t, err := time.Parse(amzDateFormat, q.Get("X-Amz-Date"))
+		if err != nil {
+			return false
+		}
+		expires, _ := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if time.Since(t) > time.Duration(expires)*time.Second {
+			return false
+		}
+		for _, name := range []string{"X-Amz-Algorithm", "X-Amz-Credential", "X-Amz-Date", "X-Amz-Expires", "X-Amz-SignedHeaders", "X-Amz-Signature"} {
+			q.Del(name)
+		}
+		u := &url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: q.Encode()}
+		signed, _ := url.Parse(f.signer.presign(r.Method, u, time.Duration(expires)*time.Second, t))
+		return signed.Query().Get("X-Amz-Signature") == sig
+	}
+	t, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for name, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-") {
+			req.Header[name] = values
+		}
+	}
+	f.signer.sign(req, r.Header.Get("X-Amz-Content-Sha256"), t)
+	return req.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.authorized(r) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		if r.ContentLength < 0 {
+			http.Error(w, "MissingContentLength", http.StatusLengthRequired)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.t.Error(err)
+		}
+		f.objects[key] = data
+		f.modified[key] = time.Now().Truncate(time.Second)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		if d := r.URL.Query().Get("response-content-disposition"); d != "" {
+			w.Header().Set("Content-Disposition", d)
+		}
+		http.ServeContent(w, r, key, f.modified[key], bytes.NewReader(data))
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	var result listResult
+	end := min(start+f.pageSize, len(keys))
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}{key, int64(len(f.objects[key])), f.modified[key]})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listResult
+	}{listResult: result})
+}
+
+// testStorage runs the operations every storage supports
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	audio := []byte("0123456789")
+	for _, name := range []string{"a.mp3", "a.jpg", "b.mp3", "c.mp3"} {
+		err := s.Put(ctx, name, bytes.NewReader(audio), int64(len(audio)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Put(ctx, "empty.mp3", strings.NewReader(""), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Stat(ctx, "a.mp3")
+	if err != nil || info.Size != 10 {
+		t.Errorf("stat: %+v, %v", info, err)
+	}
+	_, err = s.Stat(ctx, "missing.mp3")
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("stat of a missing file: %v", err)
+	}
+	_, err = s.Open(ctx, "missing.mp3")
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("open of a missing file: %v", err)
+	}
+
+	obj, err := s.Open(ctx, "a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = obj.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if _, err = io.ReadFull(obj, buf); err != nil || string(buf) != "456" {
+		t.Errorf("range read %q, %v", buf, err)
+	}
+	if size, _ := obj.Seek(0, io.SeekEnd); size != 10 {
+		t.Errorf("seek to end at %d", size)
+	}
+	if _, err = obj.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := io.ReadAll(obj); err != nil || string(all) != string(audio) {
+		t.Errorf("read %q, %v", all, err)
+	}
+	obj.Close()
+
+	files, err := s.List(ctx, "a.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"a.jpg", "a.mp3"}) {
+		t.Errorf("listed %v", names)
+	}
+	files, err = s.List(ctx, "")
+	if err != nil || len(files) != 5 {
+		t.Errorf("listed %d files, %v", len(files), err)
+	}
+
+	for _, name := range []string{"a.mp3", "a.mp3"} {
+		if err = s.Delete(ctx, name); err != nil {
+			t.Errorf("delete: %v", err)
+		}
+	}
+	_, err = s.Stat(ctx, "a.mp3")
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("stat of a deleted file: %v", err)
+	}
+}
+
+func TestFS(t *testing.T) {
+	testStorage(t, NewFS(t.TempDir()))
+}
+
+func TestS3(t *testing.T) {
+	s, _ := newFakeS3(t)
+	testStorage(t, s)
+
+	s.SecretKey = "wrong"
+	_, err := s.Stat(context.Background(), "b.mp3")
+	if err == nil || errors.Is(err, ErrNotExist) {
+		t.Errorf("stat with the wrong key: %v", err)
+	}
+}
+
+func TestS3Presign(t *testing.T) {
+	s, _ := newFakeS3(t)
+	err := s.Put(context.Background(), "a.mp3", strings.NewReader("audio"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.PresignGet("a.mp3", time.Minute, `attachment; filename="a b.mp3"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "audio" {
+		t.Errorf("presigned get: %s %q", resp.Status, body)
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="a b.mp3"` {
+		t.Errorf("disposition %q", got)
+	}
+	// the signature covers the name
+	resp, err = http.Get(strings.Replace(u, "a.mp3", "b.mp3", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("changed presigned url: %s", resp.Status)
+	}
+}
+
+func TestPublishRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, _ := newFakeS3(t)
+	path := filepath.Join(dir, "a.mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Publish(ctx, s, dir, "a.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("published file still local: %v", err)
+	}
+	restored, err := Restore(ctx, s, dir, "a.mp3")
+	if err != nil || !restored {
+		t.Fatalf("restore: %v, %v", restored, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "audio" {
+		t.Errorf("restored %q", data)
+	}
+
+	// files of a filesystem storage of dir stay where they are
+	local := NewFS(dir)
+	if err := Publish(ctx, local, dir, "a.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := Restore(ctx, local, dir, "a.mp3"); err != nil || restored {
+		t.Errorf("restore from the local storage: %v, %v", restored, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+}
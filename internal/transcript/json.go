@@ -0,0 +1,62 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// sttResult covers the json written by whisper.cpp (-oj) and by openai
+// whisper (--output_format json)
+type sttResult struct {
+	// openai whisper
+	Language string `json:"language"`
+	Segments []struct {
+		Start float64 `json:"start"` // seconds
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	} `json:"segments"`
+	// whisper.cpp
+	Result struct {
+		Language string `json:"language"`
+	} `json:"result"`
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"` // milliseconds
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text string `json:"text"`
+	} `json:"transcription"`
+}
+
+// ParseJSON reads the cues and the detected language from the json output
+// of a speech-to-text tool
+func ParseJSON(r io.Reader) ([]Cue, string, error) {
+	var result sttResult
+	err := json.NewDecoder(r).Decode(&result)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrTranscript, err)
+	}
+	var cues []Cue
+	for _, s := range result.Segments {
+		cues = append(cues, Cue{
+			Start: time.Duration(s.Start * float64(time.Second)).Round(time.Millisecond),
+			End:   time.Duration(s.End * float64(time.Second)).Round(time.Millisecond),
+			Text:  strings.TrimSpace(s.Text),
+		})
+	}
+	for _, s := range result.Transcription {
+		cues = append(cues, Cue{
+			Start: time.Duration(s.Offsets.From) * time.Millisecond,
+			End:   time.Duration(s.Offsets.To) * time.Millisecond,
+			Text:  strings.TrimSpace(s.Text),
+		})
+	}
+	lang := result.Language
+	if lang == "" {
+		lang = result.Result.Language
+	}
+	return cues, lang, nil
+}
@@ -0,0 +1,227 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrTranscript = errors.New("transcript error")
+
+// content types of the transcript files
+const (
+	TypeVTT = "text/vtt"
+	TypeSRT = "application/x-subrip"
+)
+
+// ContentType returns the content type of a transcript file extension
+func ContentType(ext string) string {
+	if ext == "srt" {
+		return TypeSRT
+	}
+	return TypeVTT
+}
+
+// Cue is a timed piece of text
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // lines separated by \n
+}
+
+// ParseVTT reads the cues of a WebVTT file. Styling tags and the inline
+// timestamps of auto-generated captions are removed.
+func ParseVTT(r io.Reader) ([]Cue, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var cues []Cue
+	var cue *Cue
+	for scanner.Scan() {
+		// auto-generated captions contain lines with a single space, only
+		// empty lines end a block
+		raw := strings.TrimRight(strings.TrimPrefix(scanner.Text(), "\ufeff"), "\r")
+		line := strings.TrimSpace(raw)
+		switch {
+		case raw == "":
+			cue = nil
+		case strings.Contains(line, "-->"):
+			start, end, err := parseTiming(line)
+			if err != nil {
+				return nil, err
+			}
+			cues = append(cues, Cue{Start: start, End: end})
+			cue = &cues[len(cues)-1]
+		case cue != nil:
+			text := html.UnescapeString(tags.ReplaceAllString(line, ""))
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if cue.Text != "" {
+				cue.Text += "\n"
+			}
+			cue.Text += strings.TrimSpace(text)
+		}
+		// the header, NOTE, STYLE and REGION blocks and cue identifiers
+		// have no timing line and are skipped
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTranscript, err)
+	}
+	return cues, nil
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+// parseTiming parses "00:01.000 --> 00:04.000 align:start"
+func parseTiming(line string) (time.Duration, time.Duration, error) {
+	from, to, _ := strings.Cut(line, "-->")
+	start, err := parseTimestamp(strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseTimestamp(strings.Fields(to)[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseTimestamp parses hh:mm:ss.ttt and mm:ss.ttt, SRT uses a comma
+func parseTimestamp(s string) (time.Duration, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("%w: invalid timestamp %q", ErrTranscript, s)
+	}
+	var d time.Duration
+	for i, part := range parts {
+		unit := time.Duration(1)
+		switch len(parts) - i {
+		case 3:
+			unit = time.Hour
+		case 2:
+			unit = time.Minute
+		}
+		if i == len(parts)-1 {
+			sec, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%w: invalid timestamp %q", ErrTranscript, s)
+			}
+			d += time.Duration(sec * float64(time.Second)).Round(time.Millisecond)
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid timestamp %q", ErrTranscript, s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// Clean removes the repetitions of auto-generated captions, which show
+// every line twice while it scrolls up. Cues without new text are dropped.
+func Clean(cues []Cue) []Cue {
+	var cleaned []Cue
+	var last string
+	for _, cue := range cues {
+		var lines []string
+		for _, line := range strings.Split(cue.Text, "\n") {
+			if line == last {
+				continue
+			}
+			lines = append(lines, line)
+			last = line
+		}
+		if len(lines) == 0 || cue.End <= cue.Start {
+			continue
+		}
+		cue.Text = strings.Join(lines, "\n")
+		cleaned = append(cleaned, cue)
+	}
+	return cleaned
+}
+
+// Map moves the cues to the times returned by fn, cues which become empty
+// are dropped
+func Map(cues []Cue, fn func(time.Duration) time.Duration) []Cue {
+	var mapped []Cue
+	for _, cue := range cues {
+		cue.Start, cue.End = fn(cue.Start), fn(cue.End)
+		if cue.End > cue.Start {
+			mapped = append(mapped, cue)
+		}
+	}
+	return mapped
+}
+
+// Text returns the words of the cues as plain text
+func Text(cues []Cue) string {
+	lines := make([]string, 0, len(cues))
+	for _, cue := range cues {
+		lines = append(lines, strings.ReplaceAll(cue.Text, "\n", " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteVTT writes cues as WebVTT
+func WriteVTT(w io.Writer, cues []Cue) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		fmt.Fprintf(b, "\n%s --> %s\n%s\n", timestamp(cue.Start, "."), timestamp(cue.End, "."), cue.Text)
+	}
+	return b.Flush()
+}
+
+// WriteSRT writes cues as SubRip
+func WriteSRT(w io.Writer, cues []Cue) error {
+	b := bufio.NewWriter(w)
+	for i, cue := range cues {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "%d\n%s --> %s\n%s\n", i+1, timestamp(cue.Start, ","), timestamp(cue.End, ","), cue.Text)
+	}
+	return b.Flush()
+}
+
+// WriteFiles writes cues to base.vtt and base.srt. The files are replaced
+// atomically, they may be served while a transcript is redone.
+func WriteFiles(base string, cues []Cue) error {
+	for ext, write := range map[string]func(io.Writer, []Cue) error{
+		"vtt": WriteVTT,
+		"srt": WriteSRT,
+	} {
+		var buf bytes.Buffer
+		err := write(&buf, cues)
+		if err != nil {
+			return err
+		}
+		dst := base + "." + ext
+		tmp := dst + ".tmp"
+		err = os.WriteFile(tmp, buf.Bytes(), 0o644)
+		if err == nil {
+			err = os.Rename(tmp, dst)
+		}
+		if err != nil {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("%w: %v", ErrTranscript, err)
+		}
+	}
+	return nil
+}
+
+// timestamp formats d as hh:mm:ss.ttt with the given decimal separator
+func timestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,117 @@
+package transcript
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// autoCaptions is shortened from youtube auto-generated captions
+const autoCaptions = `WEBVTT
+Kind: captions
+Language: en
+
+00:00:00.160 --> 00:00:02.070 align:start position:0%
+ 
+welcome<00:00:00.480><c> to</c><00:00:00.640><c> the</c><00:00:00.880><c> show</c>
+
+00:00:02.070 --> 00:00:02.080 align:start position:0%
+welcome to the show
+ 
+
+00:00:02.080 --> 00:01:05.500 align:start position:0%
+welcome to the show
+today<00:00:02.320><c> we</c><00:00:02.480><c> talk</c> &amp; laugh
+
+NOTE this is not a cue
+
+01:05.500 --> 01:06.000
+last words
+`
+
+func TestParseVTT(t *testing.T) {
+	cues, err := ParseVTT(strings.NewReader(autoCaptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cues) != 4 {
+		t.Fatalf("got %d cues: %+v", len(cues), cues)
+	}
+	if cues[0].Start != 160*time.Millisecond || cues[0].Text != "welcome to the show" {
+		t.Errorf("cue 0 = %+v", cues[0])
+	}
+	if cues[2].End != 65500*time.Millisecond || cues[2].Text != "welcome to the show\ntoday we talk & laugh" {
+		t.Errorf("cue 2 = %+v", cues[2])
+	}
+
+	cleaned := Clean(cues)
+	want := "welcome to the show\ntoday we talk & laugh\nlast words"
+	if got := Text(cleaned); got != want {
+		t.Errorf("Text(Clean()) = %q, want %q", got, want)
+	}
+}
+
+func TestWriteSRTAndVTT(t *testing.T) {
+	cues := []Cue{
+		{Start: 0, End: 1500 * time.Millisecond, Text: "one"},
+		{Start: time.Hour + 2*time.Second, End: time.Hour + 3*time.Second, Text: "two\nlines"},
+	}
+	var srt, vtt strings.Builder
+	if err := WriteSRT(&srt, cues); err != nil {
+		t.Fatal(err)
+	}
+	wantSRT := "1\n00:00:00,000 --> 00:00:01,500\none\n\n2\n01:00:02,000 --> 01:00:03,000\ntwo\nlines\n"
+	if srt.String() != wantSRT {
+		t.Errorf("WriteSRT =\n%q\nwant\n%q", srt.String(), wantSRT)
+	}
+	if err := WriteVTT(&vtt, cues); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseVTT(strings.NewReader(vtt.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[1] != cues[1] {
+		t.Errorf("round trip = %+v", parsed)
+	}
+}
+
+func TestMap(t *testing.T) {
+	cues := []Cue{
+		{Start: 0, End: 5 * time.Second, Text: "cut"},
+		{Start: 10 * time.Second, End: 20 * time.Second, Text: "kept"},
+	}
+	// everything before 10s was removed
+	mapped := Map(cues, func(d time.Duration) time.Duration {
+		return max(d-10*time.Second, 0)
+	})
+	if len(mapped) != 1 || mapped[0].Start != 0 || mapped[0].End != 10*time.Second {
+		t.Errorf("Map() = %+v", mapped)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+	}{
+		{"whisper.cpp", `{"result": {"language": "de"}, "transcription": [
+			{"timestamps": {"from": "00:00:00,000", "to": "00:00:02,500"}, "offsets": {"from": 0, "to": 2500}, "text": " Hallo"},
+			{"offsets": {"from": 2500, "to": 4000}, "text": " Welt"}]}`},
+		{"openai whisper", `{"text": "Hallo Welt", "language": "de", "segments": [
+			{"id": 0, "start": 0.0, "end": 2.5, "text": " Hallo"},
+			{"id": 1, "start": 2.5, "end": 4.0, "text": " Welt"}]}`},
+	}
+	for _, c := range cases {
+		cues, lang, err := ParseJSON(strings.NewReader(c.json))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if lang != "de" || len(cues) != 2 {
+			t.Fatalf("%s: got %q %+v", c.name, lang, cues)
+		}
+		if cues[1] != (Cue{Start: 2500 * time.Millisecond, End: 4 * time.Second, Text: "Welt"}) {
+			t.Errorf("%s: cue 1 = %+v", c.name, cues[1])
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package utils
+
+import "syscall"
+
+// FreeSpace returns the bytes available to unprivileged users on the
+// filesystem of path
+func FreeSpace(path string) (int64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 func ExtractDomain(rawurl string) (string, error) {
@@ -17,3 +19,76 @@ func ExtractDomain(rawurl string) (string, error) {
 	}
 	return strings.Join(host[len(host)-2:], "."), nil
 }
+
+// ExtractURL returns the first http(s) url found in text. Share sheets
+// often send the link embedded in a free text message.
+func ExtractURL(text string) string {
+	for _, field := range strings.Fields(text) {
+		if strings.HasPrefix(field, "http://") || strings.HasPrefix(field, "https://") {
+			return field
+		}
+	}
+	return ""
+}
+
+// maxFilename keeps names below the 255 byte limit of common filesystems
+// with room for an extension
+const maxFilename = 200
+
+// SanitizeFilename makes name safe to use as a file name on all common
+// systems: path separators and reserved characters are replaced, whitespace
+// collapsed, control characters dropped and the length limited.
+func SanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+	for len(name) > maxFilename {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "audio"
+	}
+	return name
+}
+
+// ContentDisposition returns a Content-Disposition header value for
+// filename. Non-ASCII names are sent as RFC 5987 filename* with an ASCII
+// fallback for old clients.
+func ContentDisposition(disposition, filename string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	if ascii == filename {
+		return fmt.Sprintf(`%s; filename="%s"`, disposition, filename)
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, ascii, encodeRFC5987(filename))
+}
+
+// encodeRFC5987 percent encodes all bytes that are not an attr-char
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -1,6 +1,10 @@
 package utils
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
 
 func TestExtractDomain(t *testing.T) {
 	cases := map[string]string{
@@ -19,3 +23,48 @@ func TestExtractDomain(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractURL(t *testing.T) {
+	cases := map[string]string{
+		"https://www.youtube.com/watch?v=abc":                  "https://www.youtube.com/watch?v=abc",
+		"Watch this https://youtube.com/watch?v=abc&t=1 later": "https://youtube.com/watch?v=abc&t=1",
+		"no link here": "",
+	}
+
+	for k, v := range cases {
+		if got := ExtractURL(k); got != v {
+			t.Errorf("ExtractURL does not match: %s != %s", got, v)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := map[string]string{
+		"Channel - Title":         "Channel - Title",
+		"AC/DC: Live? <2024>":     "AC_DC_ Live_ _2024_",
+		"  multi\tspace\nname.  ": "multi space name",
+		"...":                     "audio",
+		"Grüße":                   "Grüße",
+	}
+	for k, v := range cases {
+		if got := SanitizeFilename(k); got != v {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", k, got, v)
+		}
+	}
+	long := SanitizeFilename(strings.Repeat("ü", 150))
+	if len(long) > maxFilename || !utf8.ValidString(long) {
+		t.Errorf("SanitizeFilename did not cut long name: %d bytes", len(long))
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	cases := map[string]string{
+		"Channel - Title.mp3": `attachment; filename="Channel - Title.mp3"`,
+		"Grüße.mp3":           `attachment; filename="Gr__e.mp3"; filename*=UTF-8''Gr%C3%BC%C3%9Fe.mp3`,
+	}
+	for k, v := range cases {
+		if got := ContentDisposition("attachment", k); got != v {
+			t.Errorf("ContentDisposition(%q) = %q, want %q", k, got, v)
+		}
+	}
+}
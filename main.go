@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 	"tubefeed/internal/app"
 )
 
@@ -9,5 +10,12 @@ var version = "dev"
 
 func main() {
 	app := app.Setup(version)
+	// tubefeed gc [-dry-run] [-min-age 1h] cleans up the audio directory
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		if err := app.GC(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	log.Fatal(app.Run())
 }